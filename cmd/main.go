@@ -24,19 +24,19 @@ import (
 	"io"
 	"log/slog"
 	"os"
-	"smithery/forge/internal/clients/git"
-	"smithery/forge/internal/clients/github"
-	"smithery/forge/internal/clients/gitlab"
+	"os/signal"
 	"smithery/forge/internal/clients/httpclient"
-	"smithery/forge/internal/common"
 	"smithery/forge/internal/config"
-	"smithery/forge/internal/deployer"
-	"smithery/forge/internal/observer"
+	"smithery/forge/internal/metrics"
+	"smithery/forge/internal/notifier"
+	"smithery/forge/internal/webhook"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
+	"github.com/docker/docker/client"
 	"github.com/joho/godotenv"
-	"github.com/moby/moby/client"
 )
 
 const (
@@ -69,6 +69,7 @@ func run() error {
 	// config init
 	var (
 		isConfigGenerate bool
+		isTeardown       bool
 		dir              string
 		logFmt           string
 		slogHandler      slog.Handler
@@ -77,6 +78,7 @@ func run() error {
 	flag.BoolVar(&isConfigGenerate, "g", false, "generate config.yaml (must be used with '-d')")
 	flag.StringVar(&dir, "d", unspecifiedPath, "directory to config.yaml")
 	flag.StringVar(&logFmt, "fmt", logFmtText, "log format (json/text; default: text)")
+	flag.BoolVar(&isTeardown, "teardown", false, "remove the deployed container, stop its environment and exit")
 	flag.Parse()
 
 	if isConfigGenerate && dir == unspecifiedPath {
@@ -95,7 +97,7 @@ func run() error {
 	cfg := config.MustParse(dir)
 
 	// init directories
-	if err := initDir(cfg.LogOutputDir, cfg.CloneDir); err != nil {
+	if err := initDir(cfg.LogOutputDir, cfg.DataDir); err != nil {
 		return err
 	}
 
@@ -116,7 +118,11 @@ func run() error {
 	if err != nil {
 		return fmt.Errorf("failed to write to log file: %w", err)
 	}
-	defer logFile.Close()
+	defer func() {
+		// flush what was logged during shutdown
+		logFile.Sync()
+		logFile.Close()
+	}()
 
 	w := io.MultiWriter(logFile, os.Stdout)
 	if strings.ToLower(logFmt) == logFmtJSON {
@@ -129,36 +135,16 @@ func run() error {
 	slog.SetDefault(logger)
 	slog.Debug("slog initialised")
 
-	// http client init
-	ctx := context.Background()
-	httpclient := httpclient.New(cfg.HTTPTimeout * time.Second)
-	slog.Debug("http client initialised")
-
-	// git init
-	gitParams := git.GitClientParams{
-		Repository:  cfg.Repository,
-		AccessToken: cfg.AccessToken,
-		HttpClient:  httpclient,
-	}
-
-	var git git.IGitClient
-	switch cfg.Repository.Hostname() {
-	case config.GithubHost:
-		git, err = github.New(gitParams)
-	case config.GitlabHost:
-		git, err = gitlab.New(gitParams)
-	default:
-		return fmt.Errorf("git client is not specified for host %s", cfg.Repository.Hostname())
-	}
-	if err != nil {
-		return fmt.Errorf("failed to initialise git client: %w", err)
-	}
-	if err := git.Ping(ctx); err != nil {
-		return fmt.Errorf("failed to ping repository: %w", err)
-	}
-	slog.Debug("git client initialised")
+	// on SIGTERM/SIGINT, no new deploys are started and the ones in
+	// progress get the grace period to finish
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	context.AfterFunc(ctx, func() {
+		slog.Info("shutting down; waiting for deploys in progress",
+			"grace_period", cfg.GracePeriod*time.Second)
+	})
 
-	// deployer init
+	// docker client init, shared by the projects
 	dockerClient, err := client.NewClientWithOpts(client.FromEnv,
 		client.WithAPIVersionNegotiation())
 	if err != nil {
@@ -166,60 +152,100 @@ func run() error {
 	}
 
 	defer func() {
-		if err == nil {
-			err = dockerClient.Close()
+		if err := dockerClient.Close(); err != nil {
+			slog.Error("failed to close docker client", "error", err)
 		}
 	}()
 
-	// todo!: Determine deployer type
-	// common.GetDeployerType()
-	d := deployer.NewDockerfileDeployer(dockerClient)
-
-	diParams := deployer.DIParams{
-		Deployer: d,
-		Git:      git,
-		CloneDir: cfg.CloneDir,
+	httpClients := newHTTPClients(cfg.HTTPTimeout * time.Second)
+	// the projects share one notification webhook
+	var notify notifier.INotifier
+	if cfg.Notifications != nil {
+		notify = notifier.NewWebhook(notifier.WebhookParams{
+			HttpClient: httpclient.New(cfg.HTTPTimeout * time.Second),
+			URL:        cfg.Notifications.WebhookURL,
+		})
 	}
 
-	di := deployer.NewDeployInvoker(diParams)
-	slog.Debug("deploy invoker initialised")
-
-	isEmpty, err := common.IsDirEmpty(cfg.CloneDir)
-	if err != nil {
-		return fmt.Errorf("failed to check whether the dir (%s) is empty: %w", cfg.CloneDir, err)
+	var stats *metrics.Metrics
+	if cfg.Metrics != nil {
+		stats = metrics.New(metrics.MetricsParams{
+			Address: cfg.Metrics.Address,
+			Path:    cfg.Metrics.Path,
+		})
 	}
 
-	if isEmpty {
-		slog.Debug("clone dir is empty")
-		err := di.Deploy(ctx)
-		if errors.Is(err, deployer.ErrDockerfileNotExist) {
-			// at this point, deployment is not going to happen but notifications will be sent
-			slog.Warn("failed initial deployment", "error", err.Error())
-		} else if err != nil {
-			return fmt.Errorf("failed initial deployment: %w", err)
+	projects := make([]*project, 0, len(cfg.Projects))
+	for _, p := range cfg.Projects {
+		proj, err := newProject(ctx, p, cfg, dockerClient, httpClients, notify, stats)
+		if err != nil {
+			return fmt.Errorf("project %s: %w", p.Name, err)
 		}
+		projects = append(projects, proj)
 	}
 
-	// observer init & observe
-	params := observer.ObserverParams{
-		Git:      git,
-		Interval: time.Duration(cfg.ObserverInterval) * time.Second,
-		Subscriptions: []func(context.Context) error{
-			di.Deploy,
-		},
+	if isTeardown {
+		var errs []error
+		for _, p := range projects {
+			if err := p.teardown(ctx); err != nil {
+				errs = append(errs, fmt.Errorf("project %s: %w", p.cfg.Name, err))
+			}
+		}
+		return errors.Join(errs...)
 	}
 
-	o := observer.New(params)
-	slog.Debug("observer created",
-		slog.String("git_repository", params.Git.GetRawRepoURL()),
-		slog.Int("interval", int(cfg.ObserverInterval)),
-		slog.Int("subscription_length", len(params.Subscriptions)),
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
 	)
-	if err := o.Observe(ctx, cfg.Repository); err != nil {
-		return fmt.Errorf("failed to observe: %w", err)
+
+	// the webhook server only speeds deploys up; polling carries on if it fails
+	if cfg.Webhook != nil {
+		hooks := make([]webhook.Project, 0, len(projects))
+		for _, p := range projects {
+			hooks = append(hooks, p.webhook())
+		}
+		server := webhook.New(webhook.ServerParams{
+			Address:  cfg.Webhook.Address,
+			Path:     cfg.Webhook.Path,
+			Projects: hooks,
+		})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := server.Run(ctx); err != nil {
+				slog.Error("webhook server stopped", "error", err)
+			}
+		}()
+	}
+	// as with webhooks, deploys carry on without the metrics server
+	if stats != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := stats.Run(ctx); err != nil {
+				slog.Error("metrics server stopped", "error", err)
+			}
+		}()
 	}
+	// a failing project is logged and leaves the others running
+	for _, p := range projects {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := p.run(ctx); err != nil {
+				slog.Error("project stopped", "project", p.cfg.Name, "error", err)
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("project %s: %w", p.cfg.Name, err))
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	slog.Info("forge stopped")
 
-	return nil
+	return errors.Join(errs...)
 }
 
 func initDir(dirs ...string) error {
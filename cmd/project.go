@@ -0,0 +1,404 @@
+// Forge - Automated Docker container deployment tool for VPS environments.
+// Monitors Git repositories and redeploys containers on new commits.
+// Copyright (C) 2025 Artemii Fedotov
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"smithery/forge/internal/clients/git"
+	"smithery/forge/internal/clients/github"
+	"smithery/forge/internal/clients/gitlab"
+	"smithery/forge/internal/clients/httpclient"
+	"smithery/forge/internal/clients/registry"
+	"smithery/forge/internal/common"
+	"smithery/forge/internal/config"
+	"smithery/forge/internal/deployer"
+	"smithery/forge/internal/events"
+	"smithery/forge/internal/metrics"
+	"smithery/forge/internal/notifier"
+	"smithery/forge/internal/observer"
+	"smithery/forge/internal/preview"
+	"smithery/forge/internal/state"
+	"smithery/forge/internal/webhook"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/client"
+)
+
+// project is everything forge runs for one configured repository. Projects
+// share nothing but the docker client and their http clients.
+type project struct {
+	cfg      config.Project
+	git      git.IGitClient
+	ref      git.TrackedRef
+	di       *deployer.DeployInvoker
+	queue    *deployer.Queue
+	rebuilds *deployer.Rebuilder
+	images   *deployer.ImageWatcher
+	observer observer.IObserver
+	previews *preview.Manager
+}
+
+// httpClients hands out one http client per API host and credentials, so
+// that projects drawing on the same rate limit share what is known about it.
+type httpClients struct {
+	timeout time.Duration
+	clients map[string]*httpclient.HttpClient
+}
+
+func newHTTPClients(timeout time.Duration) *httpClients {
+	return &httpClients{
+		timeout: timeout,
+		clients: make(map[string]*httpclient.HttpClient),
+	}
+}
+
+func (c *httpClients) get(cfg config.Project) *httpclient.HttpClient {
+	host := cfg.Repository.Host
+	if cfg.APIURL != nil {
+		host = cfg.APIURL.Host
+	}
+	// each app installation has a rate limit of its own
+	credentials := cfg.AccessToken
+	if app := cfg.GitHubApp; app != nil {
+		credentials = fmt.Sprintf("app %d/%d", app.AppID, app.InstallationID)
+	}
+
+	key := host + "\x00" + credentials
+	if client, ok := c.clients[key]; ok {
+		return client
+	}
+	client := httpclient.New(c.timeout)
+	c.clients[key] = client
+	return client
+}
+
+func newProject(ctx context.Context, cfg config.Project, global *config.Config, dockerClient *client.Client, httpClients *httpClients, notify notifier.INotifier, stats *metrics.Metrics) (*project, error) {
+	dirs := []string{cfg.CloneDir}
+	if cfg.Previews != nil {
+		dirs = append(dirs, cfg.Previews.CloneDir)
+	}
+	if err := initDir(dirs...); err != nil {
+		return nil, err
+	}
+
+	// http client init
+	httpclient := httpClients.get(cfg)
+
+	// git init
+	ref := git.TrackedRef{
+		Branch:     cfg.Branch,
+		TagPattern: cfg.TagPattern,
+	}
+
+	clone := git.CloneParams{
+		Dir:        cfg.CloneDir,
+		Depth:      cfg.CloneDepth,
+		Submodules: cfg.Submodules,
+		LFS:        cfg.LFS,
+	}
+	if cfg.SSHKey != nil {
+		clone.SSHKey = &git.SSHKey{
+			Path:       cfg.SSHKey.Path,
+			Passphrase: cfg.SSHKey.Passphrase,
+			KnownHosts: cfg.SSHKey.KnownHosts,
+		}
+	}
+
+	var signature *git.SignaturePolicy
+	if cfg.Signature != nil {
+		signature = &git.SignaturePolicy{
+			GPGKeyring:     cfg.Signature.GPGKeyring,
+			AllowedSigners: cfg.Signature.AllowedSigners,
+		}
+	}
+
+	gitParams := git.GitClientParams{
+		Repository:  cfg.Repository,
+		AccessToken: cfg.AccessToken,
+		APIURL:      cfg.APIURL,
+		HttpClient:  httpclient,
+	}
+	if cfg.GitHubApp != nil {
+		key, err := os.ReadFile(cfg.GitHubApp.PrivateKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read github app private key: %w", err)
+		}
+		gitParams.App = &git.AppCredentials{
+			AppID:          cfg.GitHubApp.AppID,
+			InstallationID: cfg.GitHubApp.InstallationID,
+			PrivateKey:     key,
+		}
+	}
+
+	var (
+		gitClient git.IGitClient
+		err       error
+	)
+	switch cfg.Repository.Hostname() {
+	case config.GithubHost:
+		gitClient, err = github.New(gitParams)
+	case config.GitlabHost:
+		gitClient, err = gitlab.New(gitParams)
+	default:
+		return nil, fmt.Errorf("git client is not specified for host %s", cfg.Repository.Hostname())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialise git client: %w", err)
+	}
+	if err := gitClient.Ping(ctx); err != nil {
+		return nil, fmt.Errorf("failed to ping repository: %w", err)
+	}
+	slog.Debug("git client initialised", "project", cfg.Name)
+
+	// deployer init
+	var d deployer.IDeployer
+	switch cfg.Deployer {
+	case common.Dockerfile:
+		d = deployer.NewDockerfileDeployer(dockerClient)
+	default:
+		return nil, fmt.Errorf("deployer is not supported (%d)", cfg.Deployer)
+	}
+
+	st, err := state.Load(filepath.Join(global.DataDir, cfg.Name+".json"))
+	if err != nil {
+		return nil, err
+	}
+	// the observer publishes changes, the deploy invoker and the
+	// subscribers it serves receive them
+	bus := events.NewBus()
+	if notify != nil {
+		notifier.Subscribe(bus, notify)
+	}
+	if stats != nil {
+		stats.Subscribe(bus)
+	}
+
+	diParams := deployer.DIParams{
+		Project:     cfg.Name,
+		Bus:         bus,
+		Deployer:    d,
+		Git:         gitClient,
+		Ref:         ref,
+		State:       st,
+		Clone:       clone,
+		Signature:   signature,
+		GracePeriod: global.GracePeriod * time.Second,
+	}
+	if cfg.CommitStatus != nil {
+		diParams.Status = &deployer.StatusParams{
+			Context:   cfg.CommitStatus.Context,
+			TargetURL: cfg.CommitStatus.TargetURL,
+		}
+	}
+	if cfg.Deployments != nil {
+		diParams.Deployments = &deployer.DeploymentsParams{
+			Environment:    cfg.Environment,
+			EnvironmentURL: cfg.Deployments.EnvironmentURL,
+		}
+	}
+
+	di := deployer.NewDeployInvoker(diParams)
+	queueParams := deployer.QueueParams{Invoker: di, Schedule: cfg.Schedule}
+	if cfg.Debounce != nil {
+		queueParams.Settle = cfg.Debounce.Settle * time.Second
+		queueParams.MaxWait = cfg.Debounce.MaxWait * time.Second
+	}
+	queue := deployer.NewQueue(queueParams)
+	bus.Subscribe(queue.HandleChange, events.ChangeDetected, events.RebuildScheduled)
+
+	var rebuilds *deployer.Rebuilder
+	if cfg.RebuildSchedule != nil {
+		rebuilds = deployer.NewRebuilder(deployer.RebuilderParams{
+			Project:  cfg.Name,
+			Schedule: cfg.RebuildSchedule,
+			State:    st,
+			Bus:      bus,
+		})
+	}
+	slog.Debug("deploy invoker initialised", "project", cfg.Name)
+
+	var images *deployer.ImageWatcher
+	if cfg.BaseImages != nil {
+		registryClient, err := registry.New(registry.ClientParams{
+			BaseURL:    cfg.BaseImages.RegistryURL,
+			HttpClient: httpclient,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialise registry client: %w", err)
+		}
+		images = deployer.NewImageWatcher(deployer.ImageWatcherParams{
+			Project:  cfg.Name,
+			Dir:      cfg.CloneDir,
+			Registry: registryClient,
+			State:    st,
+			Bus:      bus,
+			Interval: cfg.BaseImages.Interval * time.Second,
+		})
+	}
+
+	var previews *preview.Manager
+	if cfg.Previews != nil {
+		previewClone := clone
+		previewClone.Dir = cfg.Previews.CloneDir
+		previews = preview.New(preview.ManagerParams{
+			Project:       cfg.Name,
+			Deployer:      d,
+			Git:           gitClient,
+			Clone:         previewClone,
+			Signature:     signature,
+			Max:           cfg.Previews.Max,
+			BasePort:      cfg.Previews.BasePort,
+			PortRange:     cfg.Previews.PortRange,
+			ContainerPort: cfg.Previews.ContainerPort,
+			Forks:         cfg.Previews.Forks,
+			Interval:      cfg.ObserverInterval * time.Second,
+			GracePeriod:   global.GracePeriod * time.Second,
+		})
+		slog.Debug("preview manager initialised", "project", cfg.Name)
+	}
+
+	// observer init
+	params := observer.ObserverParams{
+		Project: cfg.Name,
+		Bus:     bus,
+		Git:     gitClient,
+		Ref:     ref,
+		Filter: observer.PathFilter{
+			Paths:       cfg.Paths,
+			IgnorePaths: cfg.IgnorePaths,
+		},
+		Environment: cfg.Environment,
+		ScanRange:   cfg.ScanDirectives,
+		State:       st,
+		Interval:    cfg.ObserverInterval * time.Second,
+		Notifier:    notify,
+	}
+
+	o := observer.New(params)
+	slog.Debug("observer created",
+		"project", cfg.Name,
+		slog.String("git_repository", params.Git.GetRawRepoURL()),
+		slog.Int("interval", int(cfg.ObserverInterval)),
+	)
+
+	return &project{
+		cfg:      cfg,
+		git:      gitClient,
+		ref:      ref,
+		di:       di,
+		queue:    queue,
+		rebuilds: rebuilds,
+		images:   images,
+		observer: o,
+		previews: previews,
+	}, nil
+}
+
+// run deploys or restores the project, then observes it until the context
+// is cancelled.
+func (p *project) run(ctx context.Context) error {
+	isEmpty, err := common.IsDirEmpty(p.cfg.CloneDir)
+	if err != nil {
+		return fmt.Errorf("failed to check whether the dir (%s) is empty: %w", p.cfg.CloneDir, err)
+	}
+
+	if isEmpty {
+		slog.Debug("clone dir is empty", "project", p.cfg.Name)
+		// queued like any change, so that deploy windows apply to it as well
+		p.queue.Enqueue(events.Event{Type: events.ChangeDetected, Project: p.cfg.Name})
+	} else if err := p.di.Restore(ctx); err != nil {
+		return fmt.Errorf("failed to restore deployed revision: %w", err)
+	}
+
+	// deploys and previews in progress are waited for on shutdown
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	background := func(run func(context.Context)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			run(ctx)
+		}()
+	}
+
+	background(p.queue.Run)
+	if p.rebuilds != nil {
+		background(p.rebuilds.Run)
+	}
+	if p.images != nil {
+		background(p.images.Run)
+	}
+	if p.previews != nil {
+		background(p.previews.Run)
+	}
+
+	if err := p.observer.Observe(ctx, p.cfg.Repository); err != nil {
+		return fmt.Errorf("failed to observe: %w", err)
+	}
+	return nil
+}
+
+func (p *project) teardown(ctx context.Context) error {
+	if err := p.di.Teardown(ctx); err != nil {
+		return fmt.Errorf("failed to tear down: %w", err)
+	}
+	if p.previews != nil {
+		if err := p.previews.Teardown(ctx); err != nil {
+			return fmt.Errorf("failed to tear down previews: %w", err)
+		}
+	}
+	return nil
+}
+
+func (p *project) webhook() webhook.Project {
+	return webhook.Project{
+		Name:       p.cfg.Name,
+		Host:       p.cfg.Repository.Hostname(),
+		Repository: p.git.GetRepoAuthor() + "/" + p.git.GetRepoName(),
+		Ref:        p.ref,
+		Secret:     p.cfg.WebhookSecret,
+		Trigger:    p.observer.Trigger,
+		Status:     p.queueStatus,
+	}
+}
+
+func (p *project) queueStatus() webhook.QueueStatus {
+	q := p.queue.Status()
+	return webhook.QueueStatus{
+		Running:      change(q.Running),
+		RunningSince: q.RunningSince,
+		Pending:      change(q.Pending),
+		Fresh:        q.Fresh,
+		Coalesced:    q.Coalesced,
+		SettlesAt:    q.SettlesAt,
+		Held:         q.Held,
+		HeldUntil:    q.HeldUntil,
+		HeldReason:   q.HeldReason,
+	}
+}
+
+func change(event *events.Event) *webhook.Change {
+	if event == nil {
+		return nil
+	}
+	return &webhook.Change{Type: string(event.Type), SHA: event.SHA, Author: event.Author}
+}
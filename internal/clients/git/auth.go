@@ -0,0 +1,107 @@
+// Forge - Automated Docker container deployment tool for VPS environments.
+// Monitors Git repositories and redeploys containers on new commits.
+// Copyright (C) 2025 Artemii Fedotov
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+package git
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+)
+
+const (
+	sshUser = "git"
+	// tokenUser is the username sent along with access tokens; GitHub App
+	// installation tokens require it and other tokens ignore it
+	tokenUser = "x-access-token"
+)
+
+// SSHKey is a deploy key used to clone over SSH. Host keys are verified
+// against KnownHosts; unknown hosts are rejected.
+type SSHKey struct {
+	Path       string
+	Passphrase string
+	KnownHosts string
+}
+
+// auth returns the transport credentials for the clone: the deploy key when
+// one is set, otherwise the access token. Without either, the repository is
+// accessed anonymously.
+func (params CloneParams) auth() (transport.AuthMethod, error) {
+	if params.SSHKey != nil {
+		keys, err := ssh.NewPublicKeysFromFile(sshUser, params.SSHKey.Path, params.SSHKey.Passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load ssh key: %w", err)
+		}
+
+		keys.HostKeyCallback, err = ssh.NewKnownHostsCallback(params.SSHKey.KnownHosts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load known hosts: %w", err)
+		}
+		return keys, nil
+	}
+
+	return params.tokenAuth(), nil
+}
+
+func (params CloneParams) tokenAuth() transport.AuthMethod {
+	if params.AccessToken == "" {
+		return nil
+	}
+	return &http.BasicAuth{
+		Username: tokenUser,
+		Password: params.AccessToken,
+	}
+}
+
+// submoduleAuth returns the credentials for a submodule. A deploy key only
+// works over SSH, so submodules with HTTP(S) URLs get the access token, if
+// any, instead. Relative URLs resolve against the repository's own URL and
+// use its credentials.
+func (params CloneParams) submoduleAuth(rawURL string, auth transport.AuthMethod) transport.AuthMethod {
+	if params.SSHKey == nil {
+		return auth
+	}
+	if u, err := url.Parse(rawURL); err == nil && (u.Scheme == "https" || u.Scheme == "http") {
+		return params.tokenAuth()
+	}
+	return auth
+}
+
+// SSHRepoURL returns the scp-like SSH URL for a repository's web URL.
+func SSHRepoURL(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	path := strings.TrimSuffix(strings.TrimPrefix(u.Path, "/"), ".git")
+	return fmt.Sprintf("%s@%s:%s.git", sshUser, u.Hostname(), path), nil
+}
+
+// httpsRepoURL is the inverse of SSHRepoURL. URLs that are not scp-like are
+// returned as they are.
+func httpsRepoURL(rawURL string) string {
+	userHost, path, ok := strings.Cut(rawURL, ":")
+	if !ok || strings.Contains(userHost, "/") || strings.HasPrefix(path, "//") {
+		return rawURL
+	}
+	_, host, _ := strings.Cut(userHost, "@")
+	return fmt.Sprintf("https://%s/%s", host, path)
+}
@@ -0,0 +1,74 @@
+// Forge - Automated Docker container deployment tool for VPS environments.
+// Monitors Git repositories and redeploys containers on new commits.
+// Copyright (C) 2025 Artemii Fedotov
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+package git
+
+import (
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+func TestRepoURLs(t *testing.T) {
+	tests := []struct {
+		web, ssh, https string
+	}{
+		{"https://github.com/acme/api", "git@github.com:acme/api.git", "https://github.com/acme/api.git"},
+		{"https://github.com/acme/api.git", "git@github.com:acme/api.git", "https://github.com/acme/api.git"},
+		{"https://gitlab.example.com/group/sub/web", "git@gitlab.example.com:group/sub/web.git", "https://gitlab.example.com/group/sub/web.git"},
+	}
+	for _, tt := range tests {
+		got, err := SSHRepoURL(tt.web)
+		if err != nil || got != tt.ssh {
+			t.Errorf("SSHRepoURL(%q) = %q, %v, want %q", tt.web, got, err, tt.ssh)
+		}
+		if got := httpsRepoURL(tt.ssh); got != tt.https {
+			t.Errorf("httpsRepoURL(%q) = %q, want %q", tt.ssh, got, tt.https)
+		}
+	}
+
+	for _, raw := range []string{"https://github.com/acme/api", "http://localhost:8080/acme/api", "/srv/git/api"} {
+		if got := httpsRepoURL(raw); got != raw {
+			t.Errorf("httpsRepoURL(%q) = %q, want it unchanged", raw, got)
+		}
+	}
+}
+
+func TestSubmoduleAuth(t *testing.T) {
+	parent := transport.AuthMethod(&http.BasicAuth{Username: "parent"})
+
+	token := CloneParams{AccessToken: "t0ken"}
+	if got := token.submoduleAuth("git@github.com:acme/lib.git", parent); got != parent {
+		t.Errorf("submoduleAuth() without a deploy key = %v, want the parent's credentials", got)
+	}
+
+	deployKey := CloneParams{AccessToken: "t0ken", SSHKey: &SSHKey{Path: "id_ed25519"}}
+	for _, raw := range []string{"git@github.com:acme/lib.git", "ssh://git@github.com/acme/lib.git", "../lib.git"} {
+		if got := deployKey.submoduleAuth(raw, parent); got != parent {
+			t.Errorf("submoduleAuth(%q) = %v, want the deploy key", raw, got)
+		}
+	}
+	got, ok := deployKey.submoduleAuth("https://github.com/acme/lib.git", parent).(*http.BasicAuth)
+	if !ok || got.Password != "t0ken" {
+		t.Errorf("submoduleAuth() of an https submodule = %v, want the access token", got)
+	}
+
+	anonymous := CloneParams{SSHKey: &SSHKey{Path: "id_ed25519"}}
+	if got := anonymous.submoduleAuth("https://github.com/acme/lib.git", parent); got != nil {
+		t.Errorf("submoduleAuth() without an access token = %v, want none", got)
+	}
+}
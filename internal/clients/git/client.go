@@ -19,73 +19,205 @@ package git
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log/slog"
 	"net/url"
 	"os"
 	"smithery/forge/internal/clients/httpclient"
 	"time"
+	"unicode/utf8"
 
 	"github.com/go-git/go-git/v5"
-	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
 )
 
 var (
-	ErrNilRepoURL       = errors.New("repository URL cannot be nil")
-	ErrNilHttpClient    = errors.New("http client cannot be nil")
-	ErrEmptyAccessToken = errors.New("access token cannot be empty")
-	ErrInvalidRepoURL   = errors.New("invalid repository URL")
+	ErrNilRepoURL     = errors.New("repository URL cannot be nil")
+	ErrNilHttpClient  = errors.New("http client cannot be nil")
+	ErrInvalidRepoURL = errors.New("invalid repository URL")
 )
 
 type IGitClient interface {
 	Ping(context.Context) error
 	GetRepository(context.Context) (*Repository, error)
-	Clone(ctx context.Context, cloneDir, repoURL, accessToken string) error
+	// GetHeadCommit returns the commit a branch or tag points to
+	GetHeadCommit(ctx context.Context, ref string) (*Commit, error)
+	ListTags(context.Context) ([]Tag, error)
+	// ListPullRequests returns the open pull (merge) requests
+	ListPullRequests(context.Context) ([]PullRequest, error)
+	// Compare returns the commits and changed files between two commits
+	Compare(ctx context.Context, base, head string) (*Comparison, error)
+	SetCommitStatus(ctx context.Context, sha string, status CommitStatus) error
+	CreateDeployment(context.Context, DeploymentParams) (*Deployment, error)
+	SetDeploymentStatus(ctx context.Context, deployment *Deployment, status DeploymentStatus) error
+	// StopEnvironment marks the environment as no longer running anything
+	StopEnvironment(ctx context.Context, environment string) error
+	Clone(context.Context, CloneParams) error
+	Sync(context.Context, CloneParams) error
 	GetRawRepoURL() string
 	GetRepoName() string
 	GetRepoAuthor() string
-	GetAccessToken() string
+	// GetAccessToken returns the token used for API calls and cloning
+	GetAccessToken(context.Context) (string, error)
+	// RateLimit is the API quota last reported by the provider
+	RateLimit() httpclient.RateLimit
 }
 
 type GitClientParams struct {
 	Repository  *url.URL
 	AccessToken string
-	HttpClient  *httpclient.HttpClient
+	// App authenticates as a GitHub App installation instead of AccessToken
+	App *AppCredentials
+	// APIURL overrides the provider's API base URL
+	APIURL     *url.URL
+	HttpClient *httpclient.HttpClient
 }
 
-type Git struct{}
+// AppCredentials identify a GitHub App. Without an InstallationID, the
+// installation on the repository is looked up.
+type AppCredentials struct {
+	AppID          int64
+	InstallationID int64
+	// PrivateKey is the PEM encoded private key of the app
+	PrivateKey []byte
+}
 
-func (g *Git) Clone(ctx context.Context, cloneDir, accessToken, repoURL string) error {
-	if accessToken == "" {
-		return errors.New("access token cannot be empty")
-	}
+type CloneParams struct {
+	Dir         string
+	URL         string
+	AccessToken string
+	// Ref is checked out instead of the default branch when set
+	Ref plumbing.ReferenceName
+	// Revision, when set, is checked out instead of the head of Ref; it has
+	// to be within the fetched history
+	Revision string
+	// Depth limits the history fetched to the given number of commits
+	Depth int
+	// Submodules initialises submodules recursively with the same credentials
+	Submodules bool
+	// LFS replaces LFS pointers in the checked out revision with their content
+	LFS bool
+	// SSHKey makes the clone go over SSH instead of HTTPS when set
+	SSHKey *SSHKey
+}
+
+type Git struct {
+	HttpClient *httpclient.HttpClient
+}
 
-	if cloneDir == "" {
+func (g *Git) Clone(ctx context.Context, params CloneParams) error {
+	if params.Dir == "" {
 		return errors.New("clone dir cannot be empty")
 	}
 
-	if repoURL == "" {
+	if params.URL == "" {
 		return errors.New("repo url cannot be empty")
 	}
 
-	slog.Info("cloning repository", "clone_dir", cloneDir, "repo_url", repoURL)
-	auth := &http.BasicAuth{
-		Username: "bearer",
-		Password: accessToken,
+	// pull request refs cannot be cloned directly, only fetched
+	if params.Ref != "" && !params.Ref.IsBranch() && !params.Ref.IsTag() {
+		return g.cloneRef(ctx, params)
 	}
 
-	repo, err := git.PlainCloneContext(ctx, cloneDir, false, &git.CloneOptions{
-		Auth:     auth,
-		URL:      repoURL,
-		Progress: os.Stdout,
-	})
+	slog.Info("cloning repository",
+		"clone_dir", params.Dir, "repo_url", params.URL, "ref", params.Ref.String())
+	auth, err := params.auth()
+	if err != nil {
+		return err
+	}
+
+	opts := &git.CloneOptions{
+		Auth:          auth,
+		URL:           params.URL,
+		ReferenceName: params.Ref,
+		SingleBranch:  params.Ref != "",
+		Depth:         params.Depth,
+		Progress:      os.Stdout,
+	}
+	if params.Submodules {
+		opts.RecurseSubmodules = git.DefaultSubmoduleRecursionDepth
+		opts.ShallowSubmodules = params.Depth > 0
+	}
+
+	repo, err := git.PlainCloneContext(ctx, params.Dir, false, opts)
 	if err != nil {
 		return err
 	}
+
+	if params.LFS {
+		if err := g.pullLFS(ctx, params); err != nil {
+			return fmt.Errorf("failed to fetch lfs objects: %w", err)
+		}
+	}
 	slog.Info("repository cloned successfully",
-		"clone_dir", cloneDir, "repo_url", repoURL, "repository", repo)
+		"clone_dir", params.Dir, "repo_url", params.URL, "repository", repo)
 	return nil
 }
 
+// cloneRef initialises an empty repository and fetches the ref into it.
+func (g *Git) cloneRef(ctx context.Context, params CloneParams) error {
+	slog.Info("cloning repository",
+		"clone_dir", params.Dir, "repo_url", params.URL, "ref", params.Ref.String())
+	repo, err := git.PlainInit(params.Dir, false)
+	if err != nil {
+		return err
+	}
+
+	_, err = repo.CreateRemote(&config.RemoteConfig{
+		Name: remoteName,
+		URLs: []string{params.URL},
+	})
+	if err != nil {
+		return err
+	}
+
+	// HEAD is detached, since there is no branch to point it to; the fetch
+	// resets it to the fetched commit
+	if err := repo.Storer.SetReference(plumbing.NewHashReference(plumbing.HEAD, plumbing.ZeroHash)); err != nil {
+		return err
+	}
+	return g.fetch(ctx, params)
+}
+
+// HeadSHA returns the commit SHA checked out in the clone dir.
+func HeadSHA(cloneDir string) (string, error) {
+	repo, err := git.PlainOpen(cloneDir)
+	if err != nil {
+		return "", err
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return "", err
+	}
+	return head.Hash().String(), nil
+}
+
+// HeadCommit returns the commit checked out in the clone dir.
+func HeadCommit(cloneDir string) (*Commit, error) {
+	repo, err := git.PlainOpen(cloneDir)
+	if err != nil {
+		return nil, err
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return nil, err
+	}
+
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return nil, err
+	}
+	return &Commit{
+		SHA:         commit.Hash.String(),
+		Message:     commit.Message,
+		Author:      commit.Author.Name,
+		CommittedAt: commit.Committer.When,
+	}, nil
+}
+
 func ValidateParams(params GitClientParams) error {
 	if params.Repository == nil {
 		return ErrNilRepoURL
@@ -95,19 +227,129 @@ func ValidateParams(params GitClientParams) error {
 		return ErrNilHttpClient
 	}
 
-	if params.AccessToken == "" {
-		return ErrEmptyAccessToken
-	}
 	return nil
 }
 
 type Repository struct {
-	Id          int64     `json:"id"`
-	Name        string    `json:"name"`
-	Fullname    string    `json:"full_name"`
-	Description *string   `json:"description,omitempty"`
-	Private     bool      `json:"private"`
-	PushedAt    time.Time `json:"pushed_at"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	Id            int64     `json:"id"`
+	Name          string    `json:"name"`
+	Fullname      string    `json:"full_name"`
+	Description   *string   `json:"description,omitempty"`
+	Private       bool      `json:"private"`
+	DefaultBranch string    `json:"default_branch"`
+	PushedAt      time.Time `json:"pushed_at"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+type Commit struct {
+	SHA         string
+	Message     string
+	Author      string
+	CommittedAt time.Time
+}
+
+type Comparison struct {
+	Commits []Commit
+	// Files holds the paths of changed files; renamed files are listed
+	// under both their old and new path
+	Files []string
+	// Truncated is set when the provider capped the list of files, so that
+	// a change outside Files cannot be ruled out
+	Truncated bool
+}
+
+type StatusState string
+
+const (
+	StatusPending StatusState = "pending"
+	StatusSuccess StatusState = "success"
+	StatusFailure StatusState = "failure"
+)
+
+// maxStatusDescription is the longest status description GitHub accepts
+const maxStatusDescription = 140
+
+type CommitStatus struct {
+	State       StatusState
+	Context     string
+	Description string
+	TargetURL   string
+}
+
+// ShortDescription returns the description cut to the length providers accept.
+func (s CommitStatus) ShortDescription() string {
+	return shorten(s.Description)
+}
+
+// shorten cuts the description to maxStatusDescription characters, keeping
+// multi-byte characters whole
+func shorten(description string) string {
+	if utf8.RuneCountInString(description) <= maxStatusDescription {
+		return description
+	}
+
+	var n int
+	for i := range description {
+		if n == maxStatusDescription-3 {
+			return description[:i] + "..."
+		}
+		n++
+	}
+	return description
+}
+
+type DeploymentState string
+
+const (
+	DeploymentInProgress DeploymentState = "in_progress"
+	DeploymentSuccess    DeploymentState = "success"
+	DeploymentFailure    DeploymentState = "failure"
+	// DeploymentInactive marks a deployment superseded by a newer one
+	DeploymentInactive DeploymentState = "inactive"
+)
+
+type DeploymentParams struct {
+	// Ref is the branch or tag the deployed commit was taken from
+	Ref         plumbing.ReferenceName
+	SHA         string
+	Environment string
+	// EnvironmentURL is where the deployed project can be reached
+	EnvironmentURL string
+	Description    string
+}
+
+type Deployment struct {
+	Id          int64
+	SHA         string
+	Environment string
+}
+
+type DeploymentStatus struct {
+	State          DeploymentState
+	Description    string
+	EnvironmentURL string
+}
+
+// ShortDescription returns the description cut to the length providers accept.
+func (s DeploymentStatus) ShortDescription() string {
+	return shorten(s.Description)
+}
+
+type Tag struct {
+	Name string
+	SHA  string
+}
+
+type PullRequest struct {
+	Number int
+	Title  string
+	Author string
+	// Branch is the source branch, which may belong to a fork
+	Branch string
+	SHA    string
+	// Ref is the provider's ref for the head of the pull request, which is
+	// fetchable from the repository even when the branch is in a fork
+	Ref  plumbing.ReferenceName
+	Fork bool
 }
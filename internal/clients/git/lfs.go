@@ -0,0 +1,324 @@
+// Forge - Automated Docker container deployment tool for VPS environments.
+// Monitors Git repositories and redeploys containers on new commits.
+// Copyright (C) 2025 Artemii Fedotov
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"smithery/forge/internal/common"
+	"strconv"
+	"strings"
+)
+
+const (
+	lfsMediaType    = "application/vnd.git-lfs+json"
+	lfsVersion      = "version https://git-lfs.github.com/spec/v1"
+	lfsBatchSize    = 100
+	lfsMaxPointerSz = 1024
+)
+
+type lfsPointer struct {
+	Oid  string `json:"oid"`
+	Size int64  `json:"size"`
+}
+
+type lfsBatchRequest struct {
+	Operation string       `json:"operation"`
+	Transfers []string     `json:"transfers"`
+	Ref       *lfsRef      `json:"ref,omitempty"`
+	Objects   []lfsPointer `json:"objects"`
+	HashAlgo  string       `json:"hash_algo"`
+}
+
+type lfsRef struct {
+	Name string `json:"name"`
+}
+
+type lfsBatchResponse struct {
+	Objects []struct {
+		lfsPointer
+		Actions struct {
+			Download *struct {
+				Href   string            `json:"href"`
+				Header map[string]string `json:"header"`
+			} `json:"download"`
+		} `json:"actions"`
+		Error *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	} `json:"objects"`
+}
+
+// pullLFS replaces the LFS pointer files in the worktree with their content,
+// downloaded through the LFS batch API. Objects are kept in .git/lfs/objects
+// like git-lfs does, so a hard reset that restores the pointers does not lead
+// to downloading them again.
+func (g *Git) pullLFS(ctx context.Context, params CloneParams) error {
+	pointers, err := findLFSPointers(params.Dir)
+	if err != nil {
+		return err
+	}
+	if len(pointers) == 0 {
+		return nil
+	}
+
+	var missing []lfsPointer
+	for p := range pointers {
+		if _, err := os.Stat(lfsObjectPath(params.Dir, p.Oid)); errors.Is(err, os.ErrNotExist) {
+			missing = append(missing, p)
+		} else if err != nil {
+			return err
+		}
+	}
+
+	slog.Info("fetching lfs objects",
+		"clone_dir", params.Dir, "pointers", len(pointers), "missing", len(missing))
+	for start := 0; start < len(missing); start += lfsBatchSize {
+		end := min(start+lfsBatchSize, len(missing))
+		if err := g.downloadLFS(ctx, params, missing[start:end]); err != nil {
+			return err
+		}
+	}
+
+	for p, files := range pointers {
+		for _, file := range files {
+			if err := checkoutLFSObject(params.Dir, p.Oid, file); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (g *Git) downloadLFS(ctx context.Context, params CloneParams, objects []lfsPointer) error {
+	if g.HttpClient == nil {
+		return ErrNilHttpClient
+	}
+
+	// the batch API is served over HTTPS for SSH clones as well
+	repoURL := httpsRepoURL(params.URL)
+	endpoint, err := url.Parse(strings.TrimSuffix(repoURL, ".git") + ".git/info/lfs/objects/batch")
+	if err != nil {
+		return err
+	}
+
+	headers := map[string]string{
+		"Accept":       lfsMediaType,
+		"Content-Type": lfsMediaType,
+	}
+	if params.AccessToken != "" {
+		creds := base64.StdEncoding.EncodeToString([]byte(tokenUser + ":" + params.AccessToken))
+		headers["Authorization"] = "Basic " + creds
+	}
+
+	res, err := g.HttpClient.Post(ctx, endpoint, headers, lfsBatchRequest{
+		Operation: "download",
+		Transfers: []string{"basic"},
+		Ref:       &lfsRef{Name: params.Ref.String()},
+		Objects:   objects,
+		HashAlgo:  "sha256",
+	})
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+	if !common.IsOK(res) {
+		return fmt.Errorf("lfs batch api response was %s", res.Status)
+	}
+
+	var batch lfsBatchResponse
+	if err := json.NewDecoder(res.Body).Decode(&batch); err != nil {
+		return err
+	}
+
+	for _, obj := range batch.Objects {
+		// the oid names the file the object is stored in
+		if !validOid(obj.Oid) {
+			return fmt.Errorf("lfs object %q: invalid oid", obj.Oid)
+		}
+		if obj.Error != nil {
+			return fmt.Errorf("lfs object %s: %s (%d)", obj.Oid, obj.Error.Message, obj.Error.Code)
+		}
+		if obj.Actions.Download == nil {
+			return fmt.Errorf("lfs object %s: no download action", obj.Oid)
+		}
+		err := downloadLFSObject(ctx, params.Dir, obj.lfsPointer,
+			obj.Actions.Download.Href, obj.Actions.Download.Header)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// downloadLFSObject streams the object into the LFS object store. A plain
+// http client is used since objects can take longer than the API timeout.
+func downloadLFSObject(ctx context.Context, dir string, p lfsPointer, href string, headers map[string]string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, href, nil)
+	if err != nil {
+		return err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+	if !common.IsOK(res) {
+		return fmt.Errorf("lfs object %s download response was %s", p.Oid, res.Status)
+	}
+
+	dst := lfsObjectPath(dir, p.Oid)
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), p.Oid+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, hash), res.Body)
+	if err != nil {
+		return err
+	}
+	if n != p.Size || hex.EncodeToString(hash.Sum(nil)) != p.Oid {
+		return fmt.Errorf("lfs object %s does not match its pointer", p.Oid)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+func checkoutLFSObject(dir, oid, file string) error {
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+
+	src, err := os.Open(lfsObjectPath(dir, oid))
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(file, os.O_WRONLY|os.O_TRUNC, info.Mode())
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	if _, err := io.Copy(dst, src); err != nil {
+		return err
+	}
+	return dst.Close()
+}
+
+func lfsObjectPath(dir, oid string) string {
+	return filepath.Join(dir, ".git", "lfs", "objects", oid[0:2], oid[2:4], oid)
+}
+
+// findLFSPointers maps every LFS pointer in the worktree to the files
+// holding it.
+func findLFSPointers(dir string) (map[lfsPointer][]string, error) {
+	pointers := make(map[lfsPointer][]string)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil || info.Size() > lfsMaxPointerSz {
+			return err
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if p, ok := parseLFSPointer(data); ok {
+			pointers[p] = append(pointers[p], path)
+		}
+		return nil
+	})
+	return pointers, err
+}
+
+// validOid reports whether the oid is a hex encoded SHA-256 hash, which is
+// safe to build object paths from.
+func validOid(oid string) bool {
+	b, err := hex.DecodeString(oid)
+	return err == nil && len(b) == sha256.Size
+}
+
+func parseLFSPointer(data []byte) (lfsPointer, bool) {
+	var p lfsPointer
+	if !bytes.HasPrefix(data, []byte(lfsVersion+"\n")) {
+		return p, false
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		key, value, _ := strings.Cut(scanner.Text(), " ")
+		switch key {
+		case "oid":
+			oid, ok := strings.CutPrefix(value, "sha256:")
+			if !ok || !validOid(oid) {
+				return p, false
+			}
+			p.Oid = oid
+		case "size":
+			size, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return p, false
+			}
+			p.Size = size
+		}
+	}
+	return p, p.Oid != "" && scanner.Err() == nil
+}
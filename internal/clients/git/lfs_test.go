@@ -0,0 +1,180 @@
+// Forge - Automated Docker container deployment tool for VPS environments.
+// Monitors Git repositories and redeploys containers on new commits.
+// Copyright (C) 2025 Artemii Fedotov
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+package git
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"smithery/forge/internal/clients/httpclient"
+	"strings"
+	"testing"
+	"time"
+)
+
+func lfsPointerFile(content string) (lfsPointer, string) {
+	sum := sha256.Sum256([]byte(content))
+	p := lfsPointer{Oid: hex.EncodeToString(sum[:]), Size: int64(len(content))}
+	return p, fmt.Sprintf("%s\noid sha256:%s\nsize %d\n", lfsVersion, p.Oid, p.Size)
+}
+
+func TestParseLFSPointer(t *testing.T) {
+	want, pointer := lfsPointerFile("model weights")
+
+	tests := map[string]struct {
+		data string
+		ok   bool
+	}{
+		"pointer":       {pointer, true},
+		"plain file":    {"FROM alpine\n", false},
+		"other hash":    {strings.Replace(pointer, "sha256:", "sha1:", 1), false},
+		"short oid":     {strings.Replace(pointer, want.Oid, want.Oid[:10], 1), false},
+		"path oid":      {strings.Replace(pointer, want.Oid, "../../../etc/passwd", 1), false},
+		"bad size":      {strings.Replace(pointer, "size 13", "size lots", 1), false},
+		"missing oid":   {lfsVersion + "\nsize 13\n", false},
+		"wrong version": {strings.Replace(pointer, "v1", "v2", 1), false},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, ok := parseLFSPointer([]byte(tt.data))
+			if ok != tt.ok || (ok && got != want) {
+				t.Errorf("parseLFSPointer() = %+v, %t, want %+v, %t", got, ok, want, tt.ok)
+			}
+		})
+	}
+}
+
+// newLFSServer serves the batch API and downloads of the objects, keyed by
+// oid; respond may rewrite the batch response.
+func newLFSServer(t *testing.T, objects map[string]string, downloads *int, respond func(oid string) string) *httptest.Server {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	mux.HandleFunc("POST /acme/api.git/info/lfs/objects/batch", func(w http.ResponseWriter, r *http.Request) {
+		var req lfsBatchRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var res []string
+		for _, obj := range req.Objects {
+			oid := obj.Oid
+			if respond != nil {
+				oid = respond(oid)
+			}
+			res = append(res, fmt.Sprintf(`{"oid":%q,"size":%d,"actions":{"download":{"href":"%s/objects/%s"}}}`,
+				oid, obj.Size, server.URL, obj.Oid))
+		}
+		w.Header().Set("Content-Type", lfsMediaType)
+		fmt.Fprintf(w, `{"objects":[%s]}`, strings.Join(res, ","))
+	})
+	mux.HandleFunc("GET /objects/{oid}", func(w http.ResponseWriter, r *http.Request) {
+		*downloads++
+		fmt.Fprint(w, objects[r.PathValue("oid")])
+	})
+	return server
+}
+
+func TestPullLFS(t *testing.T) {
+	const content = "model weights"
+	p, pointer := lfsPointerFile(content)
+
+	var downloads int
+	server := newLFSServer(t, map[string]string{p.Oid: content}, &downloads, nil)
+
+	dir := t.TempDir()
+	files := []string{filepath.Join(dir, "model.bin"), filepath.Join(dir, "assets", "copy.bin")}
+	checkout := func() {
+		for _, file := range files {
+			if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(file, []byte(pointer), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	g := &Git{HttpClient: httpclient.New(time.Second)}
+	params := CloneParams{Dir: dir, URL: server.URL + "/acme/api"}
+	checkout()
+	if err := g.pullLFS(context.Background(), params); err != nil {
+		t.Fatalf("pullLFS() = %v", err)
+	}
+	for _, file := range files {
+		if b, _ := os.ReadFile(file); string(b) != content {
+			t.Errorf("%s = %q, want the object's content", file, b)
+		}
+	}
+
+	// a hard reset brings the pointers back; the stored object is reused
+	checkout()
+	if err := g.pullLFS(context.Background(), params); err != nil {
+		t.Fatalf("pullLFS() after a reset = %v", err)
+	}
+	if downloads != 1 {
+		t.Errorf("object downloaded %d times, want once", downloads)
+	}
+	if b, _ := os.ReadFile(files[0]); string(b) != content {
+		t.Errorf("%s = %q after a reset, want the object's content", files[0], b)
+	}
+}
+
+func TestPullLFSRejectsBadObjects(t *testing.T) {
+	p, pointer := lfsPointerFile("model weights")
+
+	tests := map[string]struct {
+		objects map[string]string
+		respond func(oid string) string
+	}{
+		"content not matching the pointer": {
+			objects: map[string]string{p.Oid: "something else!"},
+		},
+		"oid naming a path": {
+			objects: map[string]string{p.Oid: "model weights"},
+			respond: func(string) string { return "../../../../tmp/evil" },
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var downloads int
+			server := newLFSServer(t, tt.objects, &downloads, tt.respond)
+
+			dir := t.TempDir()
+			file := filepath.Join(dir, "model.bin")
+			if err := os.WriteFile(file, []byte(pointer), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			g := &Git{HttpClient: httpclient.New(time.Second)}
+			err := g.pullLFS(context.Background(), CloneParams{Dir: dir, URL: server.URL + "/acme/api"})
+			if err == nil {
+				t.Fatal("pullLFS() = nil, want an error")
+			}
+			if b, _ := os.ReadFile(file); string(b) != pointer {
+				t.Errorf("%s = %q, want the pointer left in place", file, b)
+			}
+		})
+	}
+}
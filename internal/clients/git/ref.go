@@ -0,0 +1,203 @@
+// Forge - Automated Docker container deployment tool for VPS environments.
+// Monitors Git repositories and redeploys containers on new commits.
+// Copyright (C) 2025 Artemii Fedotov
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+package git
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// TrackedRef is the ref forge follows. At most one of Branch or TagPattern
+// is set; when both are empty the repository's default branch is followed.
+type TrackedRef struct {
+	Branch     string
+	TagPattern string
+}
+
+func (r TrackedRef) String() string {
+	switch {
+	case r.Branch != "":
+		return "branch " + r.Branch
+	case r.TagPattern != "":
+		return "tag " + r.TagPattern
+	}
+	return "default branch"
+}
+
+// Matches reports whether a pushed ref is the tracked one. defaultBranch is
+// the repository's default branch, as reported alongside the push.
+func (r TrackedRef) Matches(ref plumbing.ReferenceName, defaultBranch string) bool {
+	switch {
+	case r.Branch != "":
+		return ref.IsBranch() && ref.Short() == r.Branch
+	case r.TagPattern != "":
+		ok, _ := path.Match(r.TagPattern, ref.Short())
+		return ref.IsTag() && ok
+	}
+	return ref.IsBranch() && ref.Short() == defaultBranch
+}
+
+// ResolveRef returns the reference name that has to be checked out for the
+// tracked ref.
+func ResolveRef(ctx context.Context, client IGitClient, ref TrackedRef) (plumbing.ReferenceName, error) {
+	name, err := ResolveRefName(ctx, client, ref)
+	if err != nil {
+		return "", err
+	}
+	if ref.TagPattern != "" {
+		return plumbing.NewTagReferenceName(name), nil
+	}
+	return plumbing.NewBranchReferenceName(name), nil
+}
+
+// ResolveRefName returns the name of the branch or tag the tracked ref
+// currently stands for.
+func ResolveRefName(ctx context.Context, client IGitClient, ref TrackedRef) (string, error) {
+	switch {
+	case ref.Branch != "":
+		return ref.Branch, nil
+	case ref.TagPattern != "":
+		tag, err := LatestTag(ctx, client, ref.TagPattern)
+		if err != nil {
+			return "", err
+		}
+		return tag.Name, nil
+	}
+
+	repo, err := client.GetRepository(ctx)
+	if err != nil {
+		return "", err
+	}
+	return repo.DefaultBranch, nil
+}
+
+// LatestTag returns the highest tag matching the pattern. Tags are ordered by
+// semantic version; tags that do not parse as one sort below those that do.
+func LatestTag(ctx context.Context, client IGitClient, pattern string) (*Tag, error) {
+	tags, err := client.ListTags(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var latest *Tag
+	for _, tag := range tags {
+		ok, err := path.Match(pattern, tag.Name)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		if latest == nil || compareTags(tag.Name, latest.Name) > 0 {
+			latest = &tag
+		}
+	}
+
+	if latest == nil {
+		return nil, fmt.Errorf("no tag matches pattern %s", pattern)
+	}
+	return latest, nil
+}
+
+type semver struct {
+	core []int
+	pre  []string
+}
+
+// parseSemver parses the version part of a tag name, skipping any prefix
+// before the first digit (`v1.2.3`, `release-1.2.3`).
+func parseSemver(name string) (semver, bool) {
+	idx := strings.IndexAny(name, "0123456789")
+	if idx < 0 {
+		return semver{}, false
+	}
+
+	version, _, _ := strings.Cut(name[idx:], "+")
+	version, pre, hasPre := strings.Cut(version, "-")
+
+	parts := strings.Split(version, ".")
+	if len(parts) > 3 {
+		return semver{}, false
+	}
+
+	v := semver{core: make([]int, 3)}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return semver{}, false
+		}
+		v.core[i] = n
+	}
+	if hasPre {
+		v.pre = strings.Split(pre, ".")
+	}
+	return v, true
+}
+
+func compareTags(a, b string) int {
+	va, okA := parseSemver(a)
+	vb, okB := parseSemver(b)
+	switch {
+	case okA && !okB:
+		return 1
+	case !okA && okB:
+		return -1
+	case !okA && !okB:
+		return strings.Compare(a, b)
+	}
+
+	if c := slices.Compare(va.core, vb.core); c != 0 {
+		return c
+	}
+
+	// a version without pre-release identifiers has higher precedence
+	switch {
+	case len(va.pre) == 0 && len(vb.pre) == 0:
+		return 0
+	case len(va.pre) == 0:
+		return 1
+	case len(vb.pre) == 0:
+		return -1
+	}
+
+	for i := 0; i < len(va.pre) && i < len(vb.pre); i++ {
+		if c := comparePrerelease(va.pre[i], vb.pre[i]); c != 0 {
+			return c
+		}
+	}
+	return len(va.pre) - len(vb.pre)
+}
+
+func comparePrerelease(a, b string) int {
+	na, errA := strconv.Atoi(a)
+	nb, errB := strconv.Atoi(b)
+	switch {
+	case errA == nil && errB == nil:
+		return na - nb
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
@@ -0,0 +1,268 @@
+// Forge - Automated Docker container deployment tool for VPS environments.
+// Monitors Git repositories and redeploys containers on new commits.
+// Copyright (C) 2025 Artemii Fedotov
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	pgpSignaturePrefix = "-----BEGIN PGP SIGNATURE-----"
+	sshSignaturePrefix = "-----BEGIN SSH SIGNATURE-----"
+	sshSigMagic        = "SSHSIG"
+	sshSigNamespace    = "git"
+)
+
+var (
+	ErrUnsignedCommit  = errors.New("commit is not signed")
+	ErrUntrustedCommit = errors.New("commit signature is not trusted")
+)
+
+// SignaturePolicy lists the keys commits have to be signed with. GPG
+// signatures are checked against an armored keyring, SSH signatures against
+// an allowed signers file (see ssh-keygen(1)).
+type SignaturePolicy struct {
+	GPGKeyring     string
+	AllowedSigners string
+}
+
+// VerifyHeadSignature checks the signature of the commit checked out in the
+// clone dir. It fails with ErrUnsignedCommit or ErrUntrustedCommit when the
+// commit must not be deployed.
+func VerifyHeadSignature(cloneDir string, policy SignaturePolicy) error {
+	repo, err := git.PlainOpen(cloneDir)
+	if err != nil {
+		return err
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return err
+	}
+
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case commit.PGPSignature == "":
+		return fmt.Errorf("%w: %s", ErrUnsignedCommit, commit.Hash)
+	case strings.HasPrefix(commit.PGPSignature, pgpSignaturePrefix):
+		return verifyGPG(commit, policy.GPGKeyring)
+	case strings.HasPrefix(commit.PGPSignature, sshSignaturePrefix):
+		return verifySSH(commit, policy.AllowedSigners)
+	}
+	return fmt.Errorf("%w: %s: unknown signature format", ErrUntrustedCommit, commit.Hash)
+}
+
+func verifyGPG(commit *object.Commit, keyring string) error {
+	if keyring == "" {
+		return fmt.Errorf("%w: %s: gpg signatures are not accepted", ErrUntrustedCommit, commit.Hash)
+	}
+
+	armored, err := os.ReadFile(keyring)
+	if err != nil {
+		return fmt.Errorf("failed to read gpg keyring: %w", err)
+	}
+
+	entity, err := commit.Verify(string(armored))
+	if err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrUntrustedCommit, commit.Hash, err)
+	}
+
+	var signer string
+	for name := range entity.Identities {
+		signer = name
+		break
+	}
+	slog.Info("commit signature verified", "sha", commit.Hash.String(), "type", "gpg", "signer", signer)
+	return nil
+}
+
+func verifySSH(commit *object.Commit, allowedSigners string) error {
+	if allowedSigners == "" {
+		return fmt.Errorf("%w: %s: ssh signatures are not accepted", ErrUntrustedCommit, commit.Hash)
+	}
+
+	signers, err := parseAllowedSigners(allowedSigners)
+	if err != nil {
+		return fmt.Errorf("failed to read allowed signers: %w", err)
+	}
+
+	payload := &plumbing.MemoryObject{}
+	if err := commit.EncodeWithoutSignature(payload); err != nil {
+		return err
+	}
+	r, err := payload.Reader()
+	if err != nil {
+		return err
+	}
+	message, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	key, err := verifySSHSig([]byte(commit.PGPSignature), message)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrUntrustedCommit, commit.Hash, err)
+	}
+
+	for _, signer := range signers {
+		if bytes.Equal(signer.key.Marshal(), key.Marshal()) && signer.allows(sshSigNamespace) {
+			slog.Info("commit signature verified",
+				"sha", commit.Hash.String(), "type", "ssh", "signer", signer.principals)
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s: key %s is not an allowed signer",
+		ErrUntrustedCommit, commit.Hash, ssh.FingerprintSHA256(key))
+}
+
+type sshSigBlob struct {
+	Magic         [6]byte
+	Version       uint32
+	PublicKey     []byte
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Signature     []byte
+}
+
+type sshSigSignedData struct {
+	Magic         [6]byte
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Hash          []byte
+}
+
+// verifySSHSig verifies an armored signature in the format of
+// PROTOCOL.sshsig and returns the key it was made with.
+func verifySSHSig(armored, message []byte) (ssh.PublicKey, error) {
+	block, _ := pem.Decode(armored)
+	if block == nil || block.Type != "SSH SIGNATURE" {
+		return nil, errors.New("malformed ssh signature")
+	}
+
+	var sig sshSigBlob
+	if err := ssh.Unmarshal(block.Bytes, &sig); err != nil {
+		return nil, err
+	}
+	if string(sig.Magic[:]) != sshSigMagic || sig.Version != 1 {
+		return nil, errors.New("unsupported ssh signature version")
+	}
+	if sig.Namespace != sshSigNamespace {
+		return nil, fmt.Errorf("ssh signature namespace is %q", sig.Namespace)
+	}
+
+	var h hash.Hash
+	switch sig.HashAlgorithm {
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return nil, fmt.Errorf("unsupported ssh signature hash %s", sig.HashAlgorithm)
+	}
+	h.Write(message)
+
+	key, err := ssh.ParsePublicKey(sig.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var signature ssh.Signature
+	if err := ssh.Unmarshal(sig.Signature, &signature); err != nil {
+		return nil, err
+	}
+
+	signed := sshSigSignedData{
+		Namespace:     sig.Namespace,
+		Reserved:      sig.Reserved,
+		HashAlgorithm: sig.HashAlgorithm,
+		Hash:          h.Sum(nil),
+	}
+	copy(signed.Magic[:], sshSigMagic)
+	if err := key.Verify(ssh.Marshal(signed), &signature); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+type allowedSigner struct {
+	principals string
+	key        ssh.PublicKey
+	namespaces []string
+}
+
+func (s allowedSigner) allows(namespace string) bool {
+	return len(s.namespaces) == 0 || slices.Contains(s.namespaces, namespace)
+}
+
+// parseAllowedSigners reads an allowed signers file: one
+// `principals [options] keytype key [comment]` entry per line.
+func parseAllowedSigners(path string) ([]allowedSigner, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var signers []allowedSigner
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		principals, rest, _ := strings.Cut(line, " ")
+		// the remainder has the layout of an authorized_keys entry
+		key, _, options, _, err := ssh.ParseAuthorizedKey([]byte(rest))
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed signer %s: %w", principals, err)
+		}
+
+		signer := allowedSigner{principals: principals, key: key}
+		for _, opt := range options {
+			name, value, _ := strings.Cut(opt, "=")
+			if strings.EqualFold(name, "namespaces") {
+				signer.namespaces = strings.Split(strings.Trim(value, `"`), ",")
+			}
+		}
+		signers = append(signers, signer)
+	}
+	return signers, scanner.Err()
+}
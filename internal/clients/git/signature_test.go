@@ -0,0 +1,162 @@
+// Forge - Automated Docker container deployment tool for VPS environments.
+// Monitors Git repositories and redeploys containers on new commits.
+// Copyright (C) 2025 Artemii Fedotov
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+package git
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/pem"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"golang.org/x/crypto/ssh"
+)
+
+func newSigner(t *testing.T) ssh.Signer {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+// sshSign signs the message as `ssh-keygen -Y sign` does.
+func sshSign(t *testing.T, signer ssh.Signer, namespace string, message []byte) string {
+	hash := sha512.Sum512(message)
+	signed := sshSigSignedData{
+		Namespace:     namespace,
+		HashAlgorithm: "sha512",
+		Hash:          hash[:],
+	}
+	copy(signed.Magic[:], sshSigMagic)
+	signature, err := signer.Sign(rand.Reader, ssh.Marshal(signed))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blob := sshSigBlob{
+		Version:       1,
+		PublicKey:     signer.PublicKey().Marshal(),
+		Namespace:     namespace,
+		HashAlgorithm: "sha512",
+		Signature:     ssh.Marshal(signature),
+	}
+	copy(blob.Magic[:], sshSigMagic)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "SSH SIGNATURE", Bytes: ssh.Marshal(blob)}))
+}
+
+// signedCommit returns a commit signed with the key in the namespace.
+func signedCommit(t *testing.T, signer ssh.Signer, namespace string) *object.Commit {
+	who := object.Signature{Name: "Ada", Email: "ada@example.com", When: time.Unix(1700000000, 0).UTC()}
+	commit := &object.Commit{
+		Author:    who,
+		Committer: who,
+		Message:   "Deploy me\n",
+		TreeHash:  plumbing.NewHash("4b825dc642cb6eb9a060e54bf8d69288fbee4904"),
+	}
+
+	payload := &plumbing.MemoryObject{}
+	if err := commit.EncodeWithoutSignature(payload); err != nil {
+		t.Fatal(err)
+	}
+	r, err := payload.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	message, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit.PGPSignature = sshSign(t, signer, namespace, message)
+	return commit
+}
+
+func writeAllowedSigners(t *testing.T, lines ...string) string {
+	path := filepath.Join(t.TempDir(), "allowed_signers")
+	var content string
+	for _, line := range lines {
+		content += line + "\n"
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func authorizedKey(signer ssh.Signer) string {
+	key := ssh.MarshalAuthorizedKey(signer.PublicKey())
+	return string(key[:len(key)-1])
+}
+
+func TestVerifySSH(t *testing.T) {
+	trusted, other := newSigner(t), newSigner(t)
+	allowed := writeAllowedSigners(t,
+		"# deploy signers",
+		"ada@example.com "+authorizedKey(trusted),
+		`ci@example.com namespaces="file" `+authorizedKey(other),
+	)
+
+	tests := map[string]struct {
+		commit  *object.Commit
+		trusted bool
+	}{
+		"valid":                       {signedCommit(t, trusted, sshSigNamespace), true},
+		"wrong key":                   {signedCommit(t, newSigner(t), sshSigNamespace), false},
+		"wrong signature namespace":   {signedCommit(t, trusted, "file"), false},
+		"signer limited to namespace": {signedCommit(t, other, sshSigNamespace), false},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := verifySSH(tt.commit, allowed)
+			if tt.trusted && err != nil {
+				t.Errorf("verifySSH() = %v, want nil", err)
+			}
+			if !tt.trusted && !errors.Is(err, ErrUntrustedCommit) {
+				t.Errorf("verifySSH() = %v, want ErrUntrustedCommit", err)
+			}
+		})
+	}
+}
+
+func TestVerifySSHTamperedCommit(t *testing.T) {
+	signer := newSigner(t)
+	commit := signedCommit(t, signer, sshSigNamespace)
+	commit.Message = "Deploy something else\n"
+
+	err := verifySSH(commit, writeAllowedSigners(t, "ada@example.com "+authorizedKey(signer)))
+	if !errors.Is(err, ErrUntrustedCommit) {
+		t.Errorf("verifySSH() = %v, want ErrUntrustedCommit", err)
+	}
+}
+
+func TestVerifySSHWithoutAllowedSigners(t *testing.T) {
+	commit := signedCommit(t, newSigner(t), sshSigNamespace)
+	if err := verifySSH(commit, ""); !errors.Is(err, ErrUntrustedCommit) {
+		t.Errorf("verifySSH() = %v, want ErrUntrustedCommit", err)
+	}
+}
@@ -0,0 +1,161 @@
+// Forge - Automated Docker container deployment tool for VPS environments.
+// Monitors Git repositories and redeploys containers on new commits.
+// Copyright (C) 2025 Artemii Fedotov
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"smithery/forge/internal/common"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+const remoteName = "origin"
+
+var errStaleClone = errors.New("clone cannot be reused")
+
+// Sync brings the clone dir to the head of params.Ref, or to params.Revision
+// when set. An existing clone is
+// fetched and hard-reset; a fresh clone is made only when there is none, the
+// remote URL has changed, or the existing one is corrupted.
+func (g *Git) Sync(ctx context.Context, params CloneParams) error {
+	if params.Ref == "" {
+		return errors.New("ref cannot be empty")
+	}
+
+	err := g.fetch(ctx, params)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, errStaleClone) {
+		return err
+	}
+	slog.Info("recloning repository", "clone_dir", params.Dir, "reason", err)
+
+	if err := common.CleanDir(params.Dir); err != nil {
+		return err
+	}
+	if err := g.Clone(ctx, params); err != nil {
+		return err
+	}
+	// a clone checks out the head of the ref
+	if params.Revision != "" {
+		return g.fetch(ctx, params)
+	}
+	return nil
+}
+
+func (g *Git) fetch(ctx context.Context, params CloneParams) error {
+	auth, err := params.auth()
+	if err != nil {
+		return err
+	}
+
+	repo, err := git.PlainOpen(params.Dir)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errStaleClone, err)
+	}
+
+	remote, err := repo.Remote(remoteName)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errStaleClone, err)
+	}
+	if urls := remote.Config().URLs; len(urls) == 0 || urls[0] != params.URL {
+		return fmt.Errorf("%w: remote URL changed", errStaleClone)
+	}
+
+	local := params.Ref
+	if params.Ref.IsBranch() {
+		local = plumbing.NewRemoteReferenceName(remoteName, params.Ref.Short())
+	}
+
+	slog.Info("fetching repository",
+		"clone_dir", params.Dir, "repo_url", params.URL, "ref", params.Ref.String())
+	err = repo.FetchContext(ctx, &git.FetchOptions{
+		RemoteName: remoteName,
+		RefSpecs:   []config.RefSpec{config.RefSpec(fmt.Sprintf("+%s:%s", params.Ref, local))},
+		Depth:      params.Depth,
+		Auth:       auth,
+		Tags:       git.NoTags,
+		Force:      true,
+		Progress:   os.Stdout,
+	})
+	if errors.Is(err, plumbing.ErrObjectNotFound) {
+		return fmt.Errorf("%w: %w", errStaleClone, err)
+	} else if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return err
+	}
+
+	hash, err := repo.ResolveRevision(plumbing.Revision(local))
+	if err != nil {
+		return fmt.Errorf("%w: %w", errStaleClone, err)
+	}
+	if params.Revision != "" {
+		pinned := plumbing.NewHash(params.Revision)
+		if _, err := repo.CommitObject(pinned); err != nil {
+			return fmt.Errorf("revision %s is not in the fetched history: %w", params.Revision, err)
+		}
+		hash = &pinned
+	}
+
+	wt, err := repo.Worktree()
+	if err != nil {
+		return fmt.Errorf("%w: %w", errStaleClone, err)
+	}
+
+	if err := wt.Reset(&git.ResetOptions{Commit: *hash, Mode: git.HardReset}); err != nil {
+		return fmt.Errorf("%w: %w", errStaleClone, err)
+	}
+
+	if err := wt.Clean(&git.CleanOptions{Dir: true}); err != nil {
+		return fmt.Errorf("%w: %w", errStaleClone, err)
+	}
+
+	if params.Submodules {
+		subs, err := wt.Submodules()
+		if err != nil {
+			return fmt.Errorf("%w: %w", errStaleClone, err)
+		}
+
+		// nested submodules are fetched with the credentials of their parent
+		for _, sub := range subs {
+			err = sub.UpdateContext(ctx, &git.SubmoduleUpdateOptions{
+				Init:              true,
+				RecurseSubmodules: git.DefaultSubmoduleRecursionDepth,
+				Auth:              params.submoduleAuth(sub.Config().URL, auth),
+				Depth:             params.Depth,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to update submodule %s: %w", sub.Config().Name, err)
+			}
+		}
+	}
+
+	if params.LFS {
+		if err := g.pullLFS(ctx, params); err != nil {
+			return fmt.Errorf("failed to fetch lfs objects: %w", err)
+		}
+	}
+	slog.Info("repository fetched successfully",
+		"clone_dir", params.Dir, "repo_url", params.URL, "commit", hash.String())
+	return nil
+}
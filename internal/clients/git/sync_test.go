@@ -0,0 +1,183 @@
+// Forge - Automated Docker container deployment tool for VPS environments.
+// Monitors Git repositories and redeploys containers on new commits.
+// Copyright (C) 2025 Artemii Fedotov
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+package git
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// newUpstream creates a repository on the main branch to clone from.
+func newUpstream(t *testing.T) (string, *git.Repository) {
+	dir := t.TempDir()
+	repo, err := git.PlainInitWithOptions(dir, &git.PlainInitOptions{
+		InitOptions: git.InitOptions{DefaultBranch: plumbing.NewBranchReferenceName("main")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, repo
+}
+
+// commitFile commits the file to the repository and returns the commit SHA.
+func commitFile(t *testing.T, dir string, repo *git.Repository, name, content string) string {
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wt.Add(name); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := wt.Commit("Update "+name, &git.CommitOptions{
+		Author: &object.Signature{Name: "Ada", Email: "ada@example.com", When: time.Now()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash.String()
+}
+
+func cloneHead(t *testing.T, dir string) string {
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return head.Hash().String()
+}
+
+// markClone leaves a file in the clone's git dir, which a fetch keeps and a
+// fresh clone does not.
+func markClone(t *testing.T, dir string) string {
+	marker := filepath.Join(dir, ".git", "forge-test-marker")
+	if err := os.WriteFile(marker, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return marker
+}
+
+func TestSync(t *testing.T) {
+	ctx := context.Background()
+	upstream, repo := newUpstream(t)
+	first := commitFile(t, upstream, repo, "Dockerfile", "FROM alpine\n")
+
+	g := &Git{}
+	params := CloneParams{
+		Dir:         t.TempDir(),
+		URL:         upstream,
+		AccessToken: "t0ken",
+		Ref:         plumbing.NewBranchReferenceName("main"),
+	}
+	if err := g.Sync(ctx, params); err != nil {
+		t.Fatalf("Sync() of a new clone dir = %v", err)
+	}
+	if got := cloneHead(t, params.Dir); got != first {
+		t.Errorf("head = %s, want %s", got, first)
+	}
+
+	// an existing clone is fetched and reset, dropping local changes
+	second := commitFile(t, upstream, repo, "Dockerfile", "FROM alpine:3\n")
+	marker := markClone(t, params.Dir)
+	stray := filepath.Join(params.Dir, "stray.txt")
+	if err := os.WriteFile(stray, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(params.Dir, "Dockerfile"), []byte("FROM evil\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Sync(ctx, params); err != nil {
+		t.Fatalf("Sync() of an existing clone = %v", err)
+	}
+	if got := cloneHead(t, params.Dir); got != second {
+		t.Errorf("head = %s, want %s", got, second)
+	}
+	if _, err := os.Stat(marker); err != nil {
+		t.Errorf("clone was not reused: %v", err)
+	}
+	if _, err := os.Stat(stray); !os.IsNotExist(err) {
+		t.Errorf("untracked file survived the sync: %v", err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(params.Dir, "Dockerfile")); string(b) != "FROM alpine:3\n" {
+		t.Errorf("Dockerfile = %q, want the committed content", b)
+	}
+}
+
+func TestSyncReclones(t *testing.T) {
+	ctx := context.Background()
+	upstream, repo := newUpstream(t)
+	sha := commitFile(t, upstream, repo, "Dockerfile", "FROM alpine\n")
+
+	tests := map[string]func(t *testing.T, params *CloneParams){
+		"remote URL changed": func(t *testing.T, params *CloneParams) {
+			moved := filepath.Join(t.TempDir(), "moved")
+			if err := os.Rename(upstream, moved); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { os.Rename(moved, upstream) })
+			params.URL = moved
+		},
+		"corrupted clone": func(t *testing.T, params *CloneParams) {
+			if err := os.Remove(filepath.Join(params.Dir, ".git", "HEAD")); err != nil {
+				t.Fatal(err)
+			}
+		},
+		"not a repository": func(t *testing.T, params *CloneParams) {
+			if err := os.RemoveAll(filepath.Join(params.Dir, ".git")); err != nil {
+				t.Fatal(err)
+			}
+		},
+	}
+	for name, breakClone := range tests {
+		t.Run(name, func(t *testing.T) {
+			g := &Git{}
+			params := CloneParams{
+				Dir:         t.TempDir(),
+				URL:         upstream,
+				AccessToken: "t0ken",
+				Ref:         plumbing.NewBranchReferenceName("main"),
+			}
+			if err := g.Sync(ctx, params); err != nil {
+				t.Fatal(err)
+			}
+			marker := markClone(t, params.Dir)
+			breakClone(t, &params)
+
+			if err := g.Sync(ctx, params); err != nil {
+				t.Fatalf("Sync() = %v", err)
+			}
+			if got := cloneHead(t, params.Dir); got != sha {
+				t.Errorf("head = %s, want %s", got, sha)
+			}
+			if _, err := os.Stat(marker); !os.IsNotExist(err) {
+				t.Errorf("clone was reused: %v", err)
+			}
+		})
+	}
+}
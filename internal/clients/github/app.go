@@ -0,0 +1,210 @@
+// Forge - Automated Docker container deployment tool for VPS environments.
+// Monitors Git repositories and redeploys containers on new commits.
+// Copyright (C) 2025 Artemii Fedotov
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+package github
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"smithery/forge/internal/clients/git"
+	"smithery/forge/internal/clients/httpclient"
+	"smithery/forge/internal/common"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// jwtLifetime stays under GitHub's ten minute limit
+	jwtLifetime = 9 * time.Minute
+	// jwtClockSkew backdates the JWT in case GitHub's clock is behind
+	jwtClockSkew = time.Minute
+	// tokenRefreshMargin renews installation tokens ahead of their expiry, so
+	// a token does not run out during a clone
+	tokenRefreshMargin = 5 * time.Minute
+)
+
+var ErrInvalidPrivateKey = errors.New("invalid github app private key")
+
+// appAuth mints installation access tokens for a GitHub App.
+type appAuth struct {
+	base           *url.URL
+	author         string
+	repo           string
+	appID          int64
+	installationID int64
+	key            *rsa.PrivateKey
+	httpclient     *httpclient.HttpClient
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+func newAppAuth(base *url.URL, author, repo string, app *git.AppCredentials, httpclient *httpclient.HttpClient) (*appAuth, error) {
+	key, err := parsePrivateKey(app.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	return &appAuth{
+		base:           base,
+		author:         author,
+		repo:           repo,
+		appID:          app.AppID,
+		installationID: app.InstallationID,
+		key:            key,
+		httpclient:     httpclient,
+	}, nil
+}
+
+// GitHub hands out PKCS#1 keys, but PKCS#8 conversions are accepted as well
+func parsePrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrInvalidPrivateKey
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPrivateKey, err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: not an RSA key", ErrInvalidPrivateKey)
+	}
+	return rsaKey, nil
+}
+
+// Token returns an installation access token, minting a new one when the
+// current one is about to expire.
+func (a *appAuth) Token(ctx context.Context) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.token != "" && time.Until(a.expiresAt) > tokenRefreshMargin {
+		return a.token, nil
+	}
+
+	jwt, err := a.jwt(time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	if a.installationID == 0 {
+		if a.installationID, err = a.findInstallation(ctx, jwt); err != nil {
+			return "", fmt.Errorf("failed to find github app installation: %w", err)
+		}
+	}
+
+	token, expiresAt, err := a.createToken(ctx, jwt)
+	if err != nil {
+		return "", fmt.Errorf("failed to create installation access token: %w", err)
+	}
+	a.token, a.expiresAt = token, expiresAt
+	slog.Debug("github app installation token created",
+		slog.Int64("installation_id", a.installationID), "expires_at", expiresAt)
+	return token, nil
+}
+
+// jwt returns the RS256 signed JWT that authenticates as the app itself.
+func (a *appAuth) jwt(now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]any{
+		"iat": now.Add(-jwtClockSkew).Unix(),
+		"exp": now.Add(jwtLifetime).Unix(),
+		"iss": strconv.FormatInt(a.appID, 10),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." +
+		base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, a.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign github app jwt: %w", err)
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func appHeaders(jwt string) map[string]string {
+	return map[string]string{
+		"Accept":        "application/vnd.github+json",
+		"Authorization": "Bearer " + jwt,
+	}
+}
+
+// findInstallation looks up the app's installation on the repository.
+func (a *appAuth) findInstallation(ctx context.Context, jwt string) (int64, error) {
+	url := a.base.JoinPath("repos", a.author, a.repo, "installation")
+	res, err := a.httpclient.Get(ctx, url, appHeaders(jwt))
+	if err != nil {
+		return 0, err
+	}
+
+	defer res.Body.Close()
+	if !common.IsOK(res) {
+		return 0, fmt.Errorf("api response was %s", res.Status)
+	}
+
+	var installation struct {
+		Id int64 `json:"id"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&installation); err != nil {
+		return 0, err
+	}
+	return installation.Id, nil
+}
+
+func (a *appAuth) createToken(ctx context.Context, jwt string) (string, time.Time, error) {
+	url := a.base.JoinPath("app", "installations", strconv.FormatInt(a.installationID, 10), "access_tokens")
+	res, err := a.httpclient.Post(ctx, url, appHeaders(jwt), nil)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	defer res.Body.Close()
+	if !common.IsOK(res) {
+		return "", time.Time{}, fmt.Errorf("api response was %s", res.Status)
+	}
+
+	var token struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&token); err != nil {
+		return "", time.Time{}, err
+	}
+	return token.Token, token.ExpiresAt, nil
+}
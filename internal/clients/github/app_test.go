@@ -0,0 +1,230 @@
+// Forge - Automated Docker container deployment tool for VPS environments.
+// Monitors Git repositories and redeploys containers on new commits.
+// Copyright (C) 2025 Artemii Fedotov
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+package github
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"smithery/forge/internal/clients/git"
+	"smithery/forge/internal/clients/httpclient"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testAppID = 1234
+
+func generateKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// verifyJWT checks the RS256 signature and returns the claims
+func verifyJWT(jwt string, key *rsa.PublicKey) (map[string]any, error) {
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("jwt has %d parts, want 3", len(parts))
+	}
+
+	var header map[string]string
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	if header["alg"] != "RS256" || header["typ"] != "JWT" {
+		return nil, fmt.Errorf("jwt header = %v", header)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, fmt.Errorf("jwt signature: %w", err)
+	}
+
+	var claims map[string]any
+	err = decodeSegment(parts[1], &claims)
+	return claims, err
+}
+
+func decodeSegment(segment string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// authorized reports whether the request carries a JWT signed with the key
+func authorized(t *testing.T, w http.ResponseWriter, r *http.Request, key *rsa.PublicKey) bool {
+	if _, err := verifyJWT(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), key); err != nil {
+		t.Errorf("%s %s: %v", r.Method, r.URL.Path, err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+func newTestAppAuth(t *testing.T, key *rsa.PrivateKey, base string, installationID int64) *appAuth {
+	t.Helper()
+	u, err := url.Parse(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	auth, err := newAppAuth(u, "owner", "repo", &git.AppCredentials{
+		AppID:          testAppID,
+		InstallationID: installationID,
+		PrivateKey:     pemKey,
+	}, httpclient.New(5*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return auth
+}
+
+func TestParsePrivateKey(t *testing.T) {
+	key := generateKey(t)
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr bool
+	}{
+		{"pkcs1", pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), false},
+		{"pkcs8", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}), false},
+		{"not pem", []byte("not a key"), true},
+		{"garbage", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("garbage")}), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parsePrivateKey(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parsePrivateKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !got.Equal(key) {
+				t.Error("parsePrivateKey() returned a different key")
+			}
+		})
+	}
+}
+
+func TestJWT(t *testing.T) {
+	key := generateKey(t)
+	auth := newTestAppAuth(t, key, "https://api.github.com", 1)
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+	jwt, err := auth.jwt(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := verifyJWT(jwt, &key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if claims["iss"] != fmt.Sprint(testAppID) {
+		t.Errorf("iss = %v, want %d", claims["iss"], testAppID)
+	}
+	if iat := int64(claims["iat"].(float64)); iat != now.Add(-jwtClockSkew).Unix() {
+		t.Errorf("iat = %d, want %d", iat, now.Add(-jwtClockSkew).Unix())
+	}
+	exp := int64(claims["exp"].(float64))
+	if exp != now.Add(jwtLifetime).Unix() {
+		t.Errorf("exp = %d, want %d", exp, now.Add(jwtLifetime).Unix())
+	}
+	if lifetime := exp - int64(claims["iat"].(float64)); lifetime > int64((10 * time.Minute).Seconds()) {
+		t.Errorf("jwt lives %ds, beyond GitHub's ten minutes", lifetime)
+	}
+}
+
+func TestToken(t *testing.T) {
+	key := generateKey(t)
+	var minted atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /repos/owner/repo/installation", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(t, w, r, &key.PublicKey) {
+			return
+		}
+		fmt.Fprint(w, `{"id": 42}`)
+	})
+	mux.HandleFunc("POST /app/installations/42/access_tokens", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(t, w, r, &key.PublicKey) {
+			return
+		}
+		n := minted.Add(1)
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"token": "token-%d", "expires_at": %q}`,
+			n, time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	// without an installation ID, the installation is looked up
+	auth := newTestAppAuth(t, key, srv.URL, 0)
+	ctx := context.Background()
+
+	for range 2 {
+		token, err := auth.Token(ctx)
+		if err != nil {
+			t.Fatalf("Token() error = %v", err)
+		}
+		if token != "token-1" {
+			t.Errorf("Token() = %q, want the cached token-1", token)
+		}
+	}
+	if auth.installationID != 42 {
+		t.Errorf("installation ID = %d, want 42", auth.installationID)
+	}
+
+	// a token about to expire is replaced
+	auth.mu.Lock()
+	auth.expiresAt = time.Now().Add(tokenRefreshMargin - time.Second)
+	auth.mu.Unlock()
+
+	token, err := auth.Token(ctx)
+	if err != nil {
+		t.Fatalf("Token() error = %v", err)
+	}
+	if token != "token-2" {
+		t.Errorf("Token() = %q, want the refreshed token-2", token)
+	}
+	if n := minted.Load(); n != 2 {
+		t.Errorf("minted %d tokens, want 2", n)
+	}
+}
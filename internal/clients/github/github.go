@@ -25,15 +25,22 @@ import (
 	"smithery/forge/internal/clients/git"
 	"smithery/forge/internal/clients/httpclient"
 	"smithery/forge/internal/common"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
 )
 
+const perPage = 100
+
 type GitHubClient struct {
 	git.Git
 	base        *url.URL
 	author      string
 	repo        string
 	accessToken string
+	app         *appAuth
 	httpclient  *httpclient.HttpClient
 }
 
@@ -48,18 +55,31 @@ func New(params git.GitClientParams) (git.IGitClient, error) {
 		return nil, git.ErrInvalidRepoURL
 	}
 
-	base := url.URL{
+	base := &url.URL{
 		Scheme: "https",
 		Host:   "api.github.com",
 	}
+	if params.APIURL != nil {
+		base = params.APIURL
+	}
 
-	return &GitHubClient{
-		base:        &base,
+	gh := &GitHubClient{
+		Git:         git.Git{HttpClient: params.HttpClient},
+		base:        base,
 		accessToken: params.AccessToken,
 		author:      s[0],
 		repo:        s[1],
 		httpclient:  params.HttpClient,
-	}, nil
+	}
+
+	if params.App != nil {
+		app, err := newAppAuth(base, gh.author, gh.repo, params.App, params.HttpClient)
+		if err != nil {
+			return nil, err
+		}
+		gh.app = app
+	}
+	return gh, nil
 }
 
 func (gh *GitHubClient) Ping(ctx context.Context) error {
@@ -76,10 +96,11 @@ func (gh *GitHubClient) Ping(ctx context.Context) error {
 }
 
 func (gh *GitHubClient) GetRepository(ctx context.Context) (*git.Repository, error) {
-	headers := make(map[string]string)
-	headers["Authorization"] = fmt.Sprintf("Bearer %s", gh.accessToken)
-
 	url := gh.base.JoinPath("repos", gh.author, gh.repo)
+	headers, err := gh.authHeaders(ctx)
+	if err != nil {
+		return nil, err
+	}
 	res, err := gh.httpclient.Get(ctx, url, headers)
 	if err != nil {
 		return nil, err
@@ -102,10 +123,391 @@ func (gh *GitHubClient) GetRepository(ctx context.Context) (*git.Repository, err
 	return repo, nil
 }
 
+type commitResponse struct {
+	SHA    string `json:"sha"`
+	Commit struct {
+		Message string `json:"message"`
+		Author  struct {
+			Name string `json:"name"`
+		} `json:"author"`
+		Committer struct {
+			Date time.Time `json:"date"`
+		} `json:"committer"`
+	} `json:"commit"`
+}
+
+func (gh *GitHubClient) GetHeadCommit(ctx context.Context, ref string) (*git.Commit, error) {
+	url := gh.base.JoinPath("repos", gh.author, gh.repo, "commits", ref)
+	headers, err := gh.authHeaders(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res, err := gh.httpclient.Get(ctx, url, headers)
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Body.Close()
+	if !common.IsOK(res) {
+		return nil, fmt.Errorf("api response was %s", res.Status)
+	}
+
+	var commit commitResponse
+	if err := json.NewDecoder(res.Body).Decode(&commit); err != nil {
+		return nil, err
+	}
+	c := commit.toCommit()
+	return &c, nil
+}
+
+func (c commitResponse) toCommit() git.Commit {
+	return git.Commit{
+		SHA:         c.SHA,
+		Message:     c.Commit.Message,
+		Author:      c.Commit.Author.Name,
+		CommittedAt: c.Commit.Committer.Date,
+	}
+}
+
+// compareFileLimit is the most files GitHub lists when comparing commits
+const compareFileLimit = 300
+
+type compareResponse struct {
+	Commits []commitResponse `json:"commits"`
+	Files   []struct {
+		Filename         string `json:"filename"`
+		PreviousFilename string `json:"previous_filename"`
+	} `json:"files"`
+}
+
+func (gh *GitHubClient) Compare(ctx context.Context, base, head string) (*git.Comparison, error) {
+	url := gh.base.JoinPath("repos", gh.author, gh.repo, "compare", base+"..."+head)
+	headers, err := gh.authHeaders(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res, err := gh.httpclient.Get(ctx, url, headers)
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Body.Close()
+	if !common.IsOK(res) {
+		return nil, fmt.Errorf("api response was %s", res.Status)
+	}
+
+	var cmp compareResponse
+	if err := json.NewDecoder(res.Body).Decode(&cmp); err != nil {
+		return nil, err
+	}
+
+	comparison := &git.Comparison{Truncated: len(cmp.Files) >= compareFileLimit}
+	for _, c := range cmp.Commits {
+		comparison.Commits = append(comparison.Commits, c.toCommit())
+	}
+	for _, f := range cmp.Files {
+		comparison.Files = append(comparison.Files, f.Filename)
+		if f.PreviousFilename != "" {
+			comparison.Files = append(comparison.Files, f.PreviousFilename)
+		}
+	}
+	return comparison, nil
+}
+
+type statusRequest struct {
+	State       string `json:"state"`
+	TargetURL   string `json:"target_url,omitempty"`
+	Description string `json:"description,omitempty"`
+	Context     string `json:"context"`
+}
+
+func (gh *GitHubClient) SetCommitStatus(ctx context.Context, sha string, status git.CommitStatus) error {
+	url := gh.base.JoinPath("repos", gh.author, gh.repo, "statuses", sha)
+	headers, err := gh.authHeaders(ctx)
+	if err != nil {
+		return err
+	}
+	res, err := gh.httpclient.Post(ctx, url, headers, statusRequest{
+		State:       string(status.State),
+		TargetURL:   status.TargetURL,
+		Description: status.ShortDescription(),
+		Context:     status.Context,
+	})
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+	if !common.IsOK(res) {
+		return fmt.Errorf("api response was %s", res.Status)
+	}
+	return nil
+}
+
+type deploymentRequest struct {
+	Ref                   string   `json:"ref"`
+	Environment           string   `json:"environment"`
+	Description           string   `json:"description,omitempty"`
+	AutoMerge             bool     `json:"auto_merge"`
+	RequiredContexts      []string `json:"required_contexts"`
+	ProductionEnvironment bool     `json:"production_environment"`
+}
+
+type deploymentResponse struct {
+	Id          int64  `json:"id"`
+	SHA         string `json:"sha"`
+	Environment string `json:"environment"`
+}
+
+func (gh *GitHubClient) CreateDeployment(ctx context.Context, params git.DeploymentParams) (*git.Deployment, error) {
+	url := gh.base.JoinPath("repos", gh.author, gh.repo, "deployments")
+	headers, err := gh.authHeaders(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res, err := gh.httpclient.Post(ctx, url, headers, deploymentRequest{
+		// the SHA is deployed rather than the ref, which may have moved on
+		Ref:         params.SHA,
+		Environment: params.Environment,
+		Description: params.Description,
+		// forge has already decided to deploy; merging the default branch
+		// in or waiting for status checks (its own included) is unwanted
+		AutoMerge:             false,
+		RequiredContexts:      []string{},
+		ProductionEnvironment: params.Environment == "production",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Body.Close()
+	if !common.IsOK(res) {
+		return nil, fmt.Errorf("api response was %s", res.Status)
+	}
+
+	var deployment deploymentResponse
+	if err := json.NewDecoder(res.Body).Decode(&deployment); err != nil {
+		return nil, err
+	}
+	return &git.Deployment{
+		Id:          deployment.Id,
+		SHA:         deployment.SHA,
+		Environment: deployment.Environment,
+	}, nil
+}
+
+type deploymentStatusRequest struct {
+	State          string `json:"state"`
+	Description    string `json:"description,omitempty"`
+	EnvironmentURL string `json:"environment_url,omitempty"`
+	// superseded deployments are marked inactive by forge itself, since
+	// GitHub only does so for non-production environments
+	AutoInactive bool `json:"auto_inactive"`
+}
+
+func (gh *GitHubClient) SetDeploymentStatus(ctx context.Context, deployment *git.Deployment, status git.DeploymentStatus) error {
+	url := gh.base.JoinPath("repos", gh.author, gh.repo,
+		"deployments", strconv.FormatInt(deployment.Id, 10), "statuses")
+	headers, err := gh.authHeaders(ctx)
+	if err != nil {
+		return err
+	}
+	res, err := gh.httpclient.Post(ctx, url, headers, deploymentStatusRequest{
+		State:          string(status.State),
+		Description:    status.ShortDescription(),
+		EnvironmentURL: status.EnvironmentURL,
+		AutoInactive:   false,
+	})
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+	if !common.IsOK(res) {
+		return fmt.Errorf("api response was %s", res.Status)
+	}
+	return nil
+}
+
+// StopEnvironment marks the latest deployment to the environment inactive,
+// which GitHub shows as the environment having nothing deployed.
+func (gh *GitHubClient) StopEnvironment(ctx context.Context, environment string) error {
+	url := gh.base.JoinPath("repos", gh.author, gh.repo, "deployments")
+	query := url.Query()
+	query.Set("environment", environment)
+	query.Set("per_page", "1")
+	url.RawQuery = query.Encode()
+
+	headers, err := gh.authHeaders(ctx)
+	if err != nil {
+		return err
+	}
+	res, err := gh.httpclient.Get(ctx, url, headers)
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+	if !common.IsOK(res) {
+		return fmt.Errorf("api response was %s", res.Status)
+	}
+
+	var deployments []deploymentResponse
+	if err := json.NewDecoder(res.Body).Decode(&deployments); err != nil {
+		return err
+	}
+	if len(deployments) == 0 {
+		return nil
+	}
+
+	return gh.SetDeploymentStatus(ctx, &git.Deployment{
+		Id:          deployments[0].Id,
+		SHA:         deployments[0].SHA,
+		Environment: deployments[0].Environment,
+	}, git.DeploymentStatus{
+		State:       git.DeploymentInactive,
+		Description: "Stopped",
+	})
+}
+
+type tagResponse struct {
+	Name   string `json:"name"`
+	Commit struct {
+		SHA string `json:"sha"`
+	} `json:"commit"`
+}
+
+func (gh *GitHubClient) ListTags(ctx context.Context) ([]git.Tag, error) {
+	var tags []git.Tag
+	for page := 1; ; page++ {
+		url := gh.base.JoinPath("repos", gh.author, gh.repo, "tags")
+		query := url.Query()
+		query.Set("per_page", strconv.Itoa(perPage))
+		query.Set("page", strconv.Itoa(page))
+		url.RawQuery = query.Encode()
+
+		headers, err := gh.authHeaders(ctx)
+		if err != nil {
+			return nil, err
+		}
+		res, err := gh.httpclient.Get(ctx, url, headers)
+		if err != nil {
+			return nil, err
+		}
+
+		var batch []tagResponse
+		if common.IsOK(res) {
+			err = json.NewDecoder(res.Body).Decode(&batch)
+		} else {
+			err = fmt.Errorf("api response was %s", res.Status)
+		}
+		res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, tag := range batch {
+			tags = append(tags, git.Tag{Name: tag.Name, SHA: tag.Commit.SHA})
+		}
+		if len(batch) < perPage {
+			return tags, nil
+		}
+	}
+}
+
+type pullRequestResponse struct {
+	Number int    `json:"number"`
+	Title  string `json:"title"`
+	User   struct {
+		Login string `json:"login"`
+	} `json:"user"`
+	Head struct {
+		Ref  string `json:"ref"`
+		SHA  string `json:"sha"`
+		Repo *struct {
+			FullName string `json:"full_name"`
+		} `json:"repo"`
+	} `json:"head"`
+}
+
+func (gh *GitHubClient) ListPullRequests(ctx context.Context) ([]git.PullRequest, error) {
+	var pulls []git.PullRequest
+	for page := 1; ; page++ {
+		url := gh.base.JoinPath("repos", gh.author, gh.repo, "pulls")
+		query := url.Query()
+		query.Set("state", "open")
+		query.Set("per_page", strconv.Itoa(perPage))
+		query.Set("page", strconv.Itoa(page))
+		url.RawQuery = query.Encode()
+
+		headers, err := gh.authHeaders(ctx)
+		if err != nil {
+			return nil, err
+		}
+		res, err := gh.httpclient.Get(ctx, url, headers)
+		if err != nil {
+			return nil, err
+		}
+
+		var batch []pullRequestResponse
+		if common.IsOK(res) {
+			err = json.NewDecoder(res.Body).Decode(&batch)
+		} else {
+			err = fmt.Errorf("api response was %s", res.Status)
+		}
+		res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, pr := range batch {
+			pulls = append(pulls, git.PullRequest{
+				Number: pr.Number,
+				Title:  pr.Title,
+				Author: pr.User.Login,
+				Branch: pr.Head.Ref,
+				SHA:    pr.Head.SHA,
+				Ref:    plumbing.ReferenceName(fmt.Sprintf("refs/pull/%d/head", pr.Number)),
+				// the head repository is gone when the fork was deleted
+				Fork: pr.Head.Repo == nil ||
+					!strings.EqualFold(pr.Head.Repo.FullName, gh.author+"/"+gh.repo),
+			})
+		}
+		if len(batch) < perPage {
+			return pulls, nil
+		}
+	}
+}
+
+func (gh *GitHubClient) authHeaders(ctx context.Context) (map[string]string, error) {
+	headers := make(map[string]string)
+	token, err := gh.GetAccessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// public repositories can be observed without a token
+	if token != "" {
+		headers["Authorization"] = fmt.Sprintf("Bearer %s", token)
+	}
+	return headers, nil
+}
+
 func (gh *GitHubClient) GetRawRepoURL() string {
 	return fmt.Sprintf("https://github.com/%s/%s", gh.author, gh.repo)
 }
 
-func (gh *GitHubClient) GetAccessToken() string { return gh.accessToken }
-func (gh *GitHubClient) GetRepoName() string    { return gh.repo }
-func (gh *GitHubClient) GetRepoAuthor() string  { return gh.author }
+func (gh *GitHubClient) GetRepoName() string   { return gh.repo }
+func (gh *GitHubClient) GetRepoAuthor() string { return gh.author }
+
+// GetAccessToken returns the installation token when authenticating as a
+// GitHub App, otherwise the configured access token.
+func (gh *GitHubClient) GetAccessToken(ctx context.Context) (string, error) {
+	if gh.app != nil {
+		return gh.app.Token(ctx)
+	}
+	return gh.accessToken, nil
+}
+
+func (gh *GitHubClient) RateLimit() httpclient.RateLimit {
+	return gh.httpclient.RateLimit(gh.base.Host)
+}
@@ -18,15 +18,22 @@ package gitlab
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
 	"net/url"
 	"smithery/forge/internal/clients/git"
 	"smithery/forge/internal/clients/httpclient"
+	"smithery/forge/internal/common"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
 )
 
-var errUnimplemented = errors.New("unimplemented")
+const perPage = 100
 
 type GitLabClient struct {
 	git.Git
@@ -48,13 +55,22 @@ func New(params git.GitClientParams) (git.IGitClient, error) {
 		return nil, git.ErrInvalidRepoURL
 	}
 
-	base := url.URL{
+	if params.App != nil {
+		return nil, errors.New("github app authentication is not supported by gitlab")
+	}
+
+	base := &url.URL{
 		Scheme: "https",
-		Host:   "api.gitlab.com",
+		Host:   "gitlab.com",
+		Path:   "/api/v4",
+	}
+	if params.APIURL != nil {
+		base = params.APIURL
 	}
 
 	return &GitLabClient{
-		base:        &base,
+		Git:         git.Git{HttpClient: params.HttpClient},
+		base:        base,
 		accessToken: params.AccessToken,
 		author:      s[0],
 		repo:        s[1],
@@ -62,18 +78,462 @@ func New(params git.GitClientParams) (git.IGitClient, error) {
 	}, nil
 }
 
-func (gl *GitLabClient) Ping(_ context.Context) error {
-	return errUnimplemented
+func (gl *GitLabClient) Ping(ctx context.Context) error {
+	res, err := gl.httpclient.Get(ctx, gl.project(), gl.authHeaders())
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+	if !common.IsOK(res) {
+		return fmt.Errorf("api response was %s", res.Status)
+	}
+	return nil
+}
+
+type projectResponse struct {
+	Id                int64     `json:"id"`
+	Name              string    `json:"name"`
+	PathWithNamespace string    `json:"path_with_namespace"`
+	Description       *string   `json:"description"`
+	Visibility        string    `json:"visibility"`
+	DefaultBranch     string    `json:"default_branch"`
+	LastActivityAt    time.Time `json:"last_activity_at"`
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+func (gl *GitLabClient) GetRepository(ctx context.Context) (*git.Repository, error) {
+	res, err := gl.httpclient.Get(ctx, gl.project(), gl.authHeaders())
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Body.Close()
+	if !common.IsOK(res) {
+		return nil, fmt.Errorf("api response was %s", res.Status)
+	}
+
+	var project projectResponse
+	if err := json.NewDecoder(res.Body).Decode(&project); err != nil {
+		return nil, err
+	}
+	return &git.Repository{
+		Id:            project.Id,
+		Name:          project.Name,
+		Fullname:      project.PathWithNamespace,
+		Description:   project.Description,
+		Private:       project.Visibility != "public",
+		DefaultBranch: project.DefaultBranch,
+		PushedAt:      project.LastActivityAt,
+		CreatedAt:     project.CreatedAt,
+		UpdatedAt:     project.LastActivityAt,
+	}, nil
+}
+
+type commitResponse struct {
+	Id            string    `json:"id"`
+	Message       string    `json:"message"`
+	AuthorName    string    `json:"author_name"`
+	CommittedDate time.Time `json:"committed_date"`
+}
+
+func (gl *GitLabClient) GetHeadCommit(ctx context.Context, ref string) (*git.Commit, error) {
+	url := gl.project().JoinPath("repository", "commits", url.PathEscape(ref))
+	res, err := gl.httpclient.Get(ctx, url, gl.authHeaders())
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Body.Close()
+	if !common.IsOK(res) {
+		return nil, fmt.Errorf("api response was %s", res.Status)
+	}
+
+	var commit commitResponse
+	if err := json.NewDecoder(res.Body).Decode(&commit); err != nil {
+		return nil, err
+	}
+	c := commit.toCommit()
+	return &c, nil
+}
+
+func (c commitResponse) toCommit() git.Commit {
+	return git.Commit{
+		SHA:         c.Id,
+		Message:     c.Message,
+		Author:      c.AuthorName,
+		CommittedAt: c.CommittedDate,
+	}
+}
+
+type compareResponse struct {
+	Commits []commitResponse `json:"commits"`
+	Diffs   []struct {
+		OldPath string `json:"old_path"`
+		NewPath string `json:"new_path"`
+	} `json:"diffs"`
+}
+
+func (gl *GitLabClient) Compare(ctx context.Context, base, head string) (*git.Comparison, error) {
+	url := gl.project().JoinPath("repository", "compare")
+	query := url.Query()
+	query.Set("from", base)
+	query.Set("to", head)
+	url.RawQuery = query.Encode()
+
+	res, err := gl.httpclient.Get(ctx, url, gl.authHeaders())
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Body.Close()
+	if !common.IsOK(res) {
+		return nil, fmt.Errorf("api response was %s", res.Status)
+	}
+
+	var cmp compareResponse
+	if err := json.NewDecoder(res.Body).Decode(&cmp); err != nil {
+		return nil, err
+	}
+
+	comparison := &git.Comparison{}
+	for _, c := range cmp.Commits {
+		comparison.Commits = append(comparison.Commits, c.toCommit())
+	}
+	for _, d := range cmp.Diffs {
+		comparison.Files = append(comparison.Files, d.NewPath)
+		if d.OldPath != d.NewPath {
+			comparison.Files = append(comparison.Files, d.OldPath)
+		}
+	}
+	return comparison, nil
+}
+
+type statusRequest struct {
+	State       string `json:"state"`
+	Name        string `json:"name"`
+	TargetURL   string `json:"target_url,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+var statusStates = map[git.StatusState]string{
+	git.StatusPending: "pending",
+	git.StatusSuccess: "success",
+	git.StatusFailure: "failed",
+}
+
+func (gl *GitLabClient) SetCommitStatus(ctx context.Context, sha string, status git.CommitStatus) error {
+	url := gl.project().JoinPath("statuses", sha)
+	res, err := gl.httpclient.Post(ctx, url, gl.authHeaders(), statusRequest{
+		State:       statusStates[status.State],
+		Name:        status.Context,
+		TargetURL:   status.TargetURL,
+		Description: status.ShortDescription(),
+	})
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+	if !common.IsOK(res) {
+		return fmt.Errorf("api response was %s", res.Status)
+	}
+	return nil
+}
+
+type environmentResponse struct {
+	Id          int64  `json:"id"`
+	Name        string `json:"name"`
+	ExternalURL string `json:"external_url"`
+	State       string `json:"state"`
+}
+
+type environmentRequest struct {
+	Name        string `json:"name,omitempty"`
+	ExternalURL string `json:"external_url,omitempty"`
+}
+
+// findEnvironment returns the environment with the given name, or nil if
+// there is none.
+func (gl *GitLabClient) findEnvironment(ctx context.Context, name string) (*environmentResponse, error) {
+	url := gl.project().JoinPath("environments")
+	query := url.Query()
+	query.Set("name", name)
+	url.RawQuery = query.Encode()
+
+	res, err := gl.httpclient.Get(ctx, url, gl.authHeaders())
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Body.Close()
+	if !common.IsOK(res) {
+		return nil, fmt.Errorf("api response was %s", res.Status)
+	}
+
+	var environments []environmentResponse
+	if err := json.NewDecoder(res.Body).Decode(&environments); err != nil {
+		return nil, err
+	}
+	for _, env := range environments {
+		if env.Name == name {
+			return &env, nil
+		}
+	}
+	return nil, nil
+}
+
+// ensureEnvironment creates the environment, or updates its external URL if
+// it already exists.
+func (gl *GitLabClient) ensureEnvironment(ctx context.Context, name, externalURL string) error {
+	env, err := gl.findEnvironment(ctx, name)
+	if err != nil {
+		return err
+	}
+	if env != nil && (externalURL == "" || env.ExternalURL == externalURL) {
+		return nil
+	}
+
+	req := environmentRequest{ExternalURL: externalURL}
+	var res *http.Response
+	if env == nil {
+		req.Name = name
+		res, err = gl.httpclient.Post(ctx, gl.project().JoinPath("environments"), gl.authHeaders(), req)
+	} else {
+		url := gl.project().JoinPath("environments", strconv.FormatInt(env.Id, 10))
+		res, err = gl.httpclient.Put(ctx, url, gl.authHeaders(), req)
+	}
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+	if !common.IsOK(res) {
+		return fmt.Errorf("api response was %s", res.Status)
+	}
+	return nil
+}
+
+type deploymentRequest struct {
+	Environment string `json:"environment"`
+	SHA         string `json:"sha"`
+	Ref         string `json:"ref"`
+	Tag         bool   `json:"tag"`
+	Status      string `json:"status"`
+}
+
+type deploymentResponse struct {
+	Id          int64  `json:"id"`
+	SHA         string `json:"sha"`
+	Environment struct {
+		Name string `json:"name"`
+	} `json:"environment"`
+}
+
+var deploymentStates = map[git.DeploymentState]string{
+	git.DeploymentInProgress: "running",
+	git.DeploymentSuccess:    "success",
+	git.DeploymentFailure:    "failed",
+}
+
+func (gl *GitLabClient) CreateDeployment(ctx context.Context, params git.DeploymentParams) (*git.Deployment, error) {
+	if err := gl.ensureEnvironment(ctx, params.Environment, params.EnvironmentURL); err != nil {
+		return nil, fmt.Errorf("failed to create environment: %w", err)
+	}
+
+	res, err := gl.httpclient.Post(ctx, gl.project().JoinPath("deployments"), gl.authHeaders(), deploymentRequest{
+		Environment: params.Environment,
+		SHA:         params.SHA,
+		Ref:         params.Ref.Short(),
+		Tag:         params.Ref.IsTag(),
+		Status:      deploymentStates[git.DeploymentInProgress],
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Body.Close()
+	if !common.IsOK(res) {
+		return nil, fmt.Errorf("api response was %s", res.Status)
+	}
+
+	var deployment deploymentResponse
+	if err := json.NewDecoder(res.Body).Decode(&deployment); err != nil {
+		return nil, err
+	}
+	return &git.Deployment{
+		Id:          deployment.Id,
+		SHA:         deployment.SHA,
+		Environment: deployment.Environment.Name,
+	}, nil
+}
+
+type deploymentStatusRequest struct {
+	Status string `json:"status"`
 }
 
-func (gl *GitLabClient) GetRepository(_ context.Context) (*git.Repository, error) {
-	return nil, errUnimplemented
+// SetDeploymentStatus updates the deployment. GitLab has no inactive state;
+// it considers a deployment superseded once a newer one succeeds.
+func (gl *GitLabClient) SetDeploymentStatus(ctx context.Context, deployment *git.Deployment, status git.DeploymentStatus) error {
+	state, ok := deploymentStates[status.State]
+	if !ok {
+		return nil
+	}
+
+	url := gl.project().JoinPath("deployments", strconv.FormatInt(deployment.Id, 10))
+	res, err := gl.httpclient.Put(ctx, url, gl.authHeaders(), deploymentStatusRequest{Status: state})
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+	if !common.IsOK(res) {
+		return fmt.Errorf("api response was %s", res.Status)
+	}
+	return nil
+}
+
+func (gl *GitLabClient) StopEnvironment(ctx context.Context, environment string) error {
+	env, err := gl.findEnvironment(ctx, environment)
+	if err != nil || env == nil || env.State == "stopped" {
+		return err
+	}
+
+	url := gl.project().JoinPath("environments", strconv.FormatInt(env.Id, 10), "stop")
+	res, err := gl.httpclient.Post(ctx, url, gl.authHeaders(), nil)
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+	if !common.IsOK(res) {
+		return fmt.Errorf("api response was %s", res.Status)
+	}
+	return nil
+}
+
+type tagResponse struct {
+	Name   string `json:"name"`
+	Commit struct {
+		Id string `json:"id"`
+	} `json:"commit"`
+}
+
+func (gl *GitLabClient) ListTags(ctx context.Context) ([]git.Tag, error) {
+	var tags []git.Tag
+	for page := 1; ; page++ {
+		url := gl.project().JoinPath("repository", "tags")
+		query := url.Query()
+		query.Set("per_page", strconv.Itoa(perPage))
+		query.Set("page", strconv.Itoa(page))
+		url.RawQuery = query.Encode()
+
+		res, err := gl.httpclient.Get(ctx, url, gl.authHeaders())
+		if err != nil {
+			return nil, err
+		}
+
+		var batch []tagResponse
+		if common.IsOK(res) {
+			err = json.NewDecoder(res.Body).Decode(&batch)
+		} else {
+			err = fmt.Errorf("api response was %s", res.Status)
+		}
+		res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, tag := range batch {
+			tags = append(tags, git.Tag{Name: tag.Name, SHA: tag.Commit.Id})
+		}
+		if len(batch) < perPage {
+			return tags, nil
+		}
+	}
+}
+
+type mergeRequestResponse struct {
+	IID    int    `json:"iid"`
+	Title  string `json:"title"`
+	Author struct {
+		Username string `json:"username"`
+	} `json:"author"`
+	SourceBranch    string `json:"source_branch"`
+	SHA             string `json:"sha"`
+	SourceProjectId int64  `json:"source_project_id"`
+	TargetProjectId int64  `json:"target_project_id"`
+}
+
+func (gl *GitLabClient) ListPullRequests(ctx context.Context) ([]git.PullRequest, error) {
+	var pulls []git.PullRequest
+	for page := 1; ; page++ {
+		url := gl.project().JoinPath("merge_requests")
+		query := url.Query()
+		query.Set("state", "opened")
+		query.Set("per_page", strconv.Itoa(perPage))
+		query.Set("page", strconv.Itoa(page))
+		url.RawQuery = query.Encode()
+
+		res, err := gl.httpclient.Get(ctx, url, gl.authHeaders())
+		if err != nil {
+			return nil, err
+		}
+
+		var batch []mergeRequestResponse
+		if common.IsOK(res) {
+			err = json.NewDecoder(res.Body).Decode(&batch)
+		} else {
+			err = fmt.Errorf("api response was %s", res.Status)
+		}
+		res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, mr := range batch {
+			pulls = append(pulls, git.PullRequest{
+				Number: mr.IID,
+				Title:  mr.Title,
+				Author: mr.Author.Username,
+				Branch: mr.SourceBranch,
+				SHA:    mr.SHA,
+				Ref:    plumbing.ReferenceName(fmt.Sprintf("refs/merge-requests/%d/head", mr.IID)),
+				Fork:   mr.SourceProjectId != mr.TargetProjectId,
+			})
+		}
+		if len(batch) < perPage {
+			return pulls, nil
+		}
+	}
+}
+
+// project returns the API URL of the project, addressed by its URL-encoded
+// path as the GitLab API expects.
+func (gl *GitLabClient) project() *url.URL {
+	return gl.base.JoinPath("projects", url.PathEscape(gl.author+"/"+gl.repo))
+}
+
+func (gl *GitLabClient) authHeaders() map[string]string {
+	headers := make(map[string]string)
+	// public repositories can be observed without a token
+	if gl.accessToken != "" {
+		headers["Authorization"] = fmt.Sprintf("Bearer %s", gl.accessToken)
+	}
+	return headers
 }
 
 func (gl *GitLabClient) GetRawRepoURL() string {
 	return fmt.Sprintf("https://gitlab.com/%s/%s", gl.author, gl.repo)
 }
 
-func (gl *GitLabClient) GetAccessToken() string { return gl.accessToken }
-func (gl *GitLabClient) GetRepoName() string    { return gl.repo }
-func (gl *GitLabClient) GetRepoAuthor() string  { return gl.author }
+func (gl *GitLabClient) GetRepoName() string   { return gl.repo }
+func (gl *GitLabClient) GetRepoAuthor() string { return gl.author }
+
+func (gl *GitLabClient) GetAccessToken(context.Context) (string, error) {
+	return gl.accessToken, nil
+}
+
+func (gl *GitLabClient) RateLimit() httpclient.RateLimit {
+	return gl.httpclient.RateLimit(gl.base.Host)
+}
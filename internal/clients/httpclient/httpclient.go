@@ -22,22 +22,39 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
+	"sync"
 	"time"
 )
 
+// maxCached bounds the number of responses kept for conditional requests
+const maxCached = 256
+
+type cachedResponse struct {
+	etag   string
+	header http.Header
+	body   []byte
+}
+
 type HttpClient struct {
 	httpClient *http.Client
+
+	mu     sync.Mutex
+	cache  map[string]cachedResponse
+	limits map[string]RateLimit
 }
 
 func New(timeout time.Duration) *HttpClient {
 	return &HttpClient{
 		httpClient: &http.Client{Timeout: timeout},
+		cache:      make(map[string]cachedResponse),
+		limits:     make(map[string]RateLimit),
 	}
 }
 
-func (c *HttpClient) request(ctx context.Context, method string, url *url.URL, headers map[string]string, body any) (*http.Response, error) {
+func (c *HttpClient) newRequest(ctx context.Context, method string, url *url.URL, headers map[string]string, body any) (*http.Request, error) {
 	var bodyReader io.Reader
 	if body != nil {
 		jsonBody, err := json.Marshal(body)
@@ -56,12 +73,96 @@ func (c *HttpClient) request(ctx context.Context, method string, url *url.URL, h
 	for k, v := range headers {
 		req.Header.Set(k, v)
 	}
+	return req, nil
+}
+
+func (c *HttpClient) do(req *http.Request) (*http.Response, error) {
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	c.recordRateLimit(req.URL.Host, res)
+	return res, nil
+}
 
-	return c.httpClient.Do(req)
+func (c *HttpClient) request(ctx context.Context, method string, url *url.URL, headers map[string]string, body any) (*http.Response, error) {
+	req, err := c.newRequest(ctx, method, url, headers, body)
+	if err != nil {
+		return nil, err
+	}
+	return c.do(req)
 }
 
+// Get sends a conditional request when an earlier response carried an ETag.
+// A 304 answer is returned as the cached 200 response, so callers see no
+// difference; GitHub does not count such requests against the rate limit.
 func (c *HttpClient) Get(ctx context.Context, url *url.URL, headers map[string]string) (*http.Response, error) {
-	return c.request(ctx, http.MethodGet, url, headers, nil)
+	req, err := c.newRequest(ctx, http.MethodGet, url, headers, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// responses differ by credentials, so they are part of the key
+	key := url.String() + "\x00" + req.Header.Get("Authorization")
+	c.mu.Lock()
+	cached, ok := c.cache[key]
+	c.mu.Unlock()
+	if ok {
+		req.Header.Set("If-None-Match", cached.etag)
+	}
+
+	res, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case ok && res.StatusCode == http.StatusNotModified:
+		res.Body.Close()
+		slog.Debug("http response not modified", "url", url.String())
+		return &http.Response{
+			Status:        "200 OK",
+			StatusCode:    http.StatusOK,
+			Proto:         res.Proto,
+			ProtoMajor:    res.ProtoMajor,
+			ProtoMinor:    res.ProtoMinor,
+			Header:        cached.header,
+			Body:          io.NopCloser(bytes.NewReader(cached.body)),
+			ContentLength: int64(len(cached.body)),
+			Request:       req,
+		}, nil
+	case res.StatusCode == http.StatusOK && res.Header.Get("ETag") != "":
+		data, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		c.store(key, cachedResponse{
+			etag:   res.Header.Get("ETag"),
+			header: res.Header.Clone(),
+			body:   data,
+		})
+		res.Body = io.NopCloser(bytes.NewReader(data))
+	}
+	return res, nil
+}
+
+func (c *HttpClient) store(key string, res cachedResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.cache[key]; !ok && len(c.cache) >= maxCached {
+		// any entry will do; the cache only saves requests
+		for k := range c.cache {
+			delete(c.cache, k)
+			break
+		}
+	}
+	c.cache[key] = res
+}
+
+func (c *HttpClient) Head(ctx context.Context, url *url.URL, headers map[string]string) (*http.Response, error) {
+	return c.request(ctx, http.MethodHead, url, headers, nil)
 }
 
 func (c *HttpClient) Post(ctx context.Context, url *url.URL, headers map[string]string, body any) (*http.Response, error) {
@@ -0,0 +1,95 @@
+// Forge - Automated Docker container deployment tool for VPS environments.
+// Monitors Git repositories and redeploys containers on new commits.
+// Copyright (C) 2025 Artemii Fedotov
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+package httpclient
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RateLimit is the API quota last reported by a host. The zero value means
+// the host did not report one.
+type RateLimit struct {
+	Limit     int
+	Remaining int
+	Reset     time.Time
+	// RetryAfter is set when the host asked to hold off until then
+	RetryAfter time.Time
+}
+
+// RateLimit returns the quota last reported by the host.
+func (c *HttpClient) RateLimit(host string) RateLimit {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.limits[host]
+}
+
+func (c *HttpClient) recordRateLimit(host string, res *http.Response) {
+	limit, ok := parseRateLimit(res.Header)
+	if !ok {
+		return
+	}
+
+	slog.Debug("rate limit",
+		"host", host,
+		slog.Int("limit", limit.Limit),
+		slog.Int("remaining", limit.Remaining),
+		"reset", limit.Reset,
+		"retry_after", limit.RetryAfter,
+	)
+
+	c.mu.Lock()
+	c.limits[host] = limit
+	c.mu.Unlock()
+}
+
+// parseRateLimit reads GitHub's X-RateLimit-* and GitLab's RateLimit-*
+// headers, along with Retry-After.
+func parseRateLimit(h http.Header) (RateLimit, bool) {
+	var limit RateLimit
+	var ok bool
+
+	for _, prefix := range []string{"X-RateLimit-", "RateLimit-"} {
+		l, err := strconv.Atoi(h.Get(prefix + "Limit"))
+		if err != nil {
+			continue
+		}
+		remaining, err := strconv.Atoi(h.Get(prefix + "Remaining"))
+		if err != nil {
+			continue
+		}
+		limit.Limit, limit.Remaining = l, remaining
+		if reset, err := strconv.ParseInt(h.Get(prefix+"Reset"), 10, 64); err == nil {
+			limit.Reset = time.Unix(reset, 0)
+		}
+		ok = true
+		break
+	}
+
+	if after := h.Get("Retry-After"); after != "" {
+		if seconds, err := strconv.Atoi(after); err == nil {
+			limit.RetryAfter = time.Now().Add(time.Duration(seconds) * time.Second)
+			ok = true
+		} else if date, err := http.ParseTime(after); err == nil {
+			limit.RetryAfter = date
+			ok = true
+		}
+	}
+	return limit, ok
+}
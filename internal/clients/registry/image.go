@@ -0,0 +1,151 @@
+// Forge - Automated Docker container deployment tool for VPS environments.
+// Monitors Git repositories and redeploys containers on new commits.
+// Copyright (C) 2025 Artemii Fedotov
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+package registry
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// DockerHub is the registry of images named without one
+const DockerHub = "docker.io"
+
+const defaultTag = "latest"
+
+var ErrPinnedImage = errors.New("image is pinned by digest")
+
+// Image is an image reference resolved to its registry, repository and tag.
+type Image struct {
+	Registry   string
+	Repository string
+	Tag        string
+}
+
+// ParseImage parses a reference such as `node:20-alpine`,
+// `ghcr.io/acme/base` or `localhost:5000/base:1`. References pinned by
+// digest are refused, as their content cannot change.
+func ParseImage(ref string) (Image, error) {
+	if strings.Contains(ref, "@") {
+		return Image{}, fmt.Errorf("%w (%s)", ErrPinnedImage, ref)
+	}
+	if ref == "" || strings.ContainsAny(ref, " \t") {
+		return Image{}, fmt.Errorf("invalid image reference (%s)", ref)
+	}
+
+	name, tag := ref, defaultTag
+	// a colon after the last slash separates the tag, one before it a port
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		name, tag = ref[:i], ref[i+1:]
+	}
+
+	image := Image{Registry: DockerHub, Repository: name, Tag: tag}
+	if host, rest, ok := strings.Cut(name, "/"); ok &&
+		(strings.ContainsAny(host, ".:") || host == "localhost") {
+		image.Registry, image.Repository = host, rest
+	}
+	if image.Registry == DockerHub && !strings.Contains(image.Repository, "/") {
+		image.Repository = "library/" + image.Repository
+	}
+	return image, nil
+}
+
+func (i Image) String() string {
+	return fmt.Sprintf("%s/%s:%s", i.Registry, i.Repository, i.Tag)
+}
+
+// BaseImages returns the images the stages of the Dockerfile are built
+// from. Stages built from earlier stages, `scratch`, images pinned by
+// digest and images named by build arguments are left out, since they
+// cannot change under a tag that can be resolved.
+func BaseImages(dockerfile io.Reader) ([]Image, error) {
+	var (
+		images []Image
+		stages []string
+	)
+	for instruction, err := range instructions(dockerfile) {
+		if err != nil {
+			return nil, err
+		}
+
+		fields := strings.Fields(instruction)
+		if len(fields) < 2 || !strings.EqualFold(fields[0], "FROM") {
+			continue
+		}
+		// flags such as --platform precede the image
+		args := slices.DeleteFunc(fields[1:], func(f string) bool { return strings.HasPrefix(f, "--") })
+		if len(args) == 0 {
+			continue
+		}
+
+		ref := args[0]
+		fromStage := slices.Contains(stages, strings.ToLower(ref))
+		if len(args) >= 3 && strings.EqualFold(args[1], "AS") {
+			stages = append(stages, strings.ToLower(args[2]))
+		}
+		if fromStage || strings.EqualFold(ref, "scratch") || strings.Contains(ref, "$") {
+			continue
+		}
+
+		image, err := ParseImage(ref)
+		if errors.Is(err, ErrPinnedImage) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if !slices.Contains(images, image) {
+			images = append(images, image)
+		}
+	}
+	return images, nil
+}
+
+// instructions yields the Dockerfile's instructions with line continuations
+// joined and comments left out.
+func instructions(r io.Reader) func(yield func(string, error) bool) {
+	return func(yield func(string, error) bool) {
+		scanner := bufio.NewScanner(r)
+		var current strings.Builder
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if strings.HasPrefix(line, "#") {
+				continue
+			}
+			if cont, ok := strings.CutSuffix(line, `\`); ok {
+				current.WriteString(cont + " ")
+				continue
+			}
+			current.WriteString(line)
+			if instruction := strings.TrimSpace(current.String()); instruction != "" {
+				if !yield(instruction, nil) {
+					return
+				}
+			}
+			current.Reset()
+		}
+		if err := scanner.Err(); err != nil {
+			yield("", err)
+			return
+		}
+		if instruction := strings.TrimSpace(current.String()); instruction != "" {
+			yield(instruction, nil)
+		}
+	}
+}
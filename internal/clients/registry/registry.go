@@ -0,0 +1,221 @@
+// Forge - Automated Docker container deployment tool for VPS environments.
+// Monitors Git repositories and redeploys containers on new commits.
+// Copyright (C) 2025 Artemii Fedotov
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"smithery/forge/internal/clients/httpclient"
+	"smithery/forge/internal/common"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dockerHubRegistry serves the images named without a registry
+const dockerHubRegistry = "registry-1.docker.io"
+
+// defaultTokenLifetime applies to tokens issued without an expiry, as the
+// token spec prescribes
+const defaultTokenLifetime = time.Minute
+
+var (
+	ErrNilHttpClient = errors.New("http client cannot be nil")
+	ErrNoDigest      = errors.New("registry did not report a digest")
+)
+
+// manifestTypes are accepted so that multi-platform images report the digest
+// of their index, which is what changes when any platform is rebuilt
+var manifestTypes = strings.Join([]string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}, ", ")
+
+type IRegistryClient interface {
+	// Digest returns the digest of the manifest the image's tag points to
+	Digest(ctx context.Context, image Image) (string, error)
+}
+
+type ClientParams struct {
+	// BaseURL, when set, is used for every registry instead of the one the
+	// image names, e.g. a local stand-in or a pull-through mirror
+	BaseURL    *url.URL
+	HttpClient *httpclient.HttpClient
+}
+
+// Client resolves tags through the registry HTTP API v2. Registries asking
+// for a bearer token get an anonymous one, so only public images resolve.
+type Client struct {
+	base       *url.URL
+	httpclient *httpclient.HttpClient
+
+	mu     sync.Mutex
+	tokens map[string]token
+}
+
+type token struct {
+	value   string
+	expires time.Time
+}
+
+func New(params ClientParams) (IRegistryClient, error) {
+	if params.HttpClient == nil {
+		return nil, ErrNilHttpClient
+	}
+	return &Client{
+		base:       params.BaseURL,
+		httpclient: params.HttpClient,
+		tokens:     make(map[string]token),
+	}, nil
+}
+
+func (c *Client) Digest(ctx context.Context, image Image) (string, error) {
+	res, err := c.head(ctx, image)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusUnauthorized {
+		if err := c.authenticate(ctx, image, res.Header.Get("WWW-Authenticate")); err != nil {
+			return "", fmt.Errorf("failed to authenticate with the registry: %w", err)
+		}
+		if res, err = c.head(ctx, image); err != nil {
+			return "", err
+		}
+		defer res.Body.Close()
+	}
+
+	if !common.IsOK(res) {
+		return "", fmt.Errorf("registry response for %s was %s", image, res.Status)
+	}
+	digest := res.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		return "", fmt.Errorf("%w (%s)", ErrNoDigest, image)
+	}
+	return digest, nil
+}
+
+func (c *Client) head(ctx context.Context, image Image) (*http.Response, error) {
+	url := c.registryURL(image).JoinPath("v2", image.Repository, "manifests", image.Tag)
+	headers := map[string]string{"Accept": manifestTypes}
+
+	c.mu.Lock()
+	if t, ok := c.tokens[c.scope(image)]; ok && time.Now().Before(t.expires) {
+		headers["Authorization"] = "Bearer " + t.value
+	}
+	c.mu.Unlock()
+
+	return c.httpclient.Head(ctx, url, headers)
+}
+
+// authenticate fetches a token as the registry's bearer challenge describes.
+func (c *Client) authenticate(ctx context.Context, image Image, challenge string) error {
+	scheme, params, ok := strings.Cut(challenge, " ")
+	if !ok || !strings.EqualFold(scheme, "bearer") {
+		return fmt.Errorf("unsupported challenge (%s)", challenge)
+	}
+
+	attrs := parseChallenge(params)
+	realm, err := url.Parse(attrs["realm"])
+	if err != nil || realm.Host == "" {
+		return fmt.Errorf("invalid token realm (%s)", attrs["realm"])
+	}
+	query := realm.Query()
+	if service := attrs["service"]; service != "" {
+		query.Set("service", service)
+	}
+	scope := attrs["scope"]
+	if scope == "" {
+		scope = fmt.Sprintf("repository:%s:pull", image.Repository)
+	}
+	query.Set("scope", scope)
+	realm.RawQuery = query.Encode()
+
+	res, err := c.httpclient.Get(ctx, realm, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if !common.IsOK(res) {
+		return fmt.Errorf("token response was %s", res.Status)
+	}
+
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return err
+	}
+	t := token{value: body.Token, expires: time.Now().Add(defaultTokenLifetime)}
+	if t.value == "" {
+		t.value = body.AccessToken
+	}
+	if body.ExpiresIn > 0 {
+		t.expires = time.Now().Add(time.Duration(body.ExpiresIn) * time.Second)
+	}
+
+	c.mu.Lock()
+	c.tokens[c.scope(image)] = t
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *Client) registryURL(image Image) *url.URL {
+	if c.base != nil {
+		return c.base
+	}
+	host := image.Registry
+	if host == DockerHub {
+		host = dockerHubRegistry
+	}
+	return &url.URL{Scheme: "https", Host: host}
+}
+
+func (c *Client) scope(image Image) string {
+	return image.Registry + "/" + image.Repository
+}
+
+// parseChallenge parses the comma separated key="value" pairs of a
+// WWW-Authenticate challenge.
+func parseChallenge(params string) map[string]string {
+	attrs := make(map[string]string)
+	for params != "" {
+		key, rest, ok := strings.Cut(strings.TrimLeft(params, " ,"), "=")
+		if !ok {
+			break
+		}
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			value, rest, _ = strings.Cut(rest[1:], `"`)
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		attrs[strings.ToLower(strings.TrimSpace(key))] = value
+		params = rest
+	}
+	return attrs
+}
@@ -0,0 +1,224 @@
+// Forge - Automated Docker container deployment tool for VPS environments.
+// Monitors Git repositories and redeploys containers on new commits.
+// Copyright (C) 2025 Artemii Fedotov
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+package registry
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"smithery/forge/internal/clients/httpclient"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const (
+	testToken  = "secret-token"
+	testDigest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+)
+
+// newTestRegistry serves one manifest behind a bearer challenge, counting the
+// tokens it hands out
+func newTestRegistry(t *testing.T, tokens *atomic.Int32) *httptest.Server {
+	t.Helper()
+	var srv *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /token", func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("scope"); got != "repository:library/alpine:pull" {
+			t.Errorf("token scope = %q", got)
+		}
+		if got := r.URL.Query().Get("service"); got != "registry.test" {
+			t.Errorf("token service = %q", got)
+		}
+		tokens.Add(1)
+		fmt.Fprintf(w, `{"token": %q, "expires_in": 300}`, testToken)
+	})
+	mux.HandleFunc("HEAD /v2/library/alpine/manifests/3.20", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+testToken {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(
+				`Bearer realm="%s/token",service="registry.test",scope="repository:library/alpine:pull"`, srv.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if !strings.Contains(r.Header.Get("Accept"), "application/vnd.oci.image.index.v1+json") {
+			t.Errorf("Accept = %q", r.Header.Get("Accept"))
+		}
+		w.Header().Set("Docker-Content-Digest", testDigest)
+	})
+	srv = httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newTestClient(t *testing.T, srv *httptest.Server) IRegistryClient {
+	t.Helper()
+	base, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := New(ClientParams{BaseURL: base, HttpClient: httpclient.New(5 * time.Second)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestDigest(t *testing.T) {
+	var tokens atomic.Int32
+	client := newTestClient(t, newTestRegistry(t, &tokens))
+	image := Image{Registry: DockerHub, Repository: "library/alpine", Tag: "3.20"}
+
+	for range 2 {
+		digest, err := client.Digest(context.Background(), image)
+		if err != nil {
+			t.Fatalf("Digest() error = %v", err)
+		}
+		if digest != testDigest {
+			t.Errorf("Digest() = %q, want %q", digest, testDigest)
+		}
+	}
+	if n := tokens.Load(); n != 1 {
+		t.Errorf("fetched %d tokens, want 1 reused while valid", n)
+	}
+}
+
+func TestDigestUnknownTag(t *testing.T) {
+	var tokens atomic.Int32
+	client := newTestClient(t, newTestRegistry(t, &tokens))
+
+	_, err := client.Digest(context.Background(), Image{Registry: DockerHub, Repository: "library/alpine", Tag: "nope"})
+	if err == nil {
+		t.Fatal("Digest() of an unknown tag succeeded")
+	}
+}
+
+func TestParseChallenge(t *testing.T) {
+	got := parseChallenge(`realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/alpine:pull,push"`)
+	want := map[string]string{
+		"realm":   "https://auth.docker.io/token",
+		"service": "registry.docker.io",
+		"scope":   "repository:library/alpine:pull,push",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseChallenge() = %v, want %v", got, want)
+	}
+}
+
+func TestParseImage(t *testing.T) {
+	tests := []struct {
+		ref     string
+		want    Image
+		wantErr bool
+	}{
+		{ref: "alpine", want: Image{DockerHub, "library/alpine", "latest"}},
+		{ref: "node:22-slim", want: Image{DockerHub, "library/node", "22-slim"}},
+		{ref: "bitnami/redis:7.4", want: Image{DockerHub, "bitnami/redis", "7.4"}},
+		{ref: "ghcr.io/owner/app:v1", want: Image{"ghcr.io", "owner/app", "v1"}},
+		{ref: "localhost:5000/app", want: Image{"localhost:5000", "app", "latest"}},
+		{ref: "localhost/app:dev", want: Image{"localhost", "app", "dev"}},
+		{ref: "alpine@sha256:0123", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			got, err := ParseImage(tt.ref)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseImage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseImage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBaseImages(t *testing.T) {
+	tests := []struct {
+		name       string
+		dockerfile string
+		want       []Image
+	}{
+		{
+			name:       "single stage",
+			dockerfile: "FROM alpine:3.20\nRUN apk add curl\n",
+			want:       []Image{{DockerHub, "library/alpine", "3.20"}},
+		},
+		{
+			name: "multi-stage aliases",
+			dockerfile: `FROM golang:1.24 AS build
+RUN go build -o /app .
+
+FROM build AS test
+RUN go test ./...
+
+FROM gcr.io/distroless/static:nonroot
+COPY --from=build /app /app
+`,
+			want: []Image{
+				{DockerHub, "library/golang", "1.24"},
+				{"gcr.io", "distroless/static", "nonroot"},
+			},
+		},
+		{
+			name:       "alias named like an image",
+			dockerfile: "FROM node:22 AS node\nFROM node\n",
+			want:       []Image{{DockerHub, "library/node", "22"}},
+		},
+		{
+			name:       "platform flag",
+			dockerfile: "FROM --platform=$BUILDPLATFORM golang:1.24 AS build\nFROM --platform=linux/amd64 alpine\n",
+			want: []Image{
+				{DockerHub, "library/golang", "1.24"},
+				{DockerHub, "library/alpine", "latest"},
+			},
+		},
+		{
+			name:       "build argument",
+			dockerfile: "ARG BASE=alpine:3.20\nFROM $BASE\nFROM ${BASE}\n",
+			want:       nil,
+		},
+		{
+			name:       "pinned by digest",
+			dockerfile: "FROM alpine:3.20@sha256:0123456789abcdef\n",
+			want:       nil,
+		},
+		{
+			name:       "scratch",
+			dockerfile: "FROM scratch\n",
+			want:       nil,
+		},
+		{
+			name:       "comments, continuations and duplicates",
+			dockerfile: "# FROM ubuntu\nfrom \\\n  alpine:3.20 \\\n  as base\nFROM alpine:3.20\n",
+			want:       []Image{{DockerHub, "library/alpine", "3.20"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := BaseImages(strings.NewReader(tt.dockerfile))
+			if err != nil {
+				t.Fatalf("BaseImages() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("BaseImages() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -17,11 +17,14 @@
 package common
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 type DeployerType int
@@ -77,6 +80,38 @@ func CleanDir(dir string) error {
 	return nil
 }
 
+// MatchGlob reports whether a slash-separated path matches the pattern. It
+// extends path.Match with `**`, which matches any number of path segments.
+func MatchGlob(pattern, name string) (bool, error) {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) (bool, error) {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := len(name); i >= 0; i-- {
+				ok, err := matchSegments(pattern[1:], name[i:])
+				if ok || err != nil {
+					return ok, err
+				}
+			}
+			return false, nil
+		}
+
+		if len(name) == 0 {
+			_, err := path.Match(pattern[0], "")
+			return false, err
+		}
+
+		ok, err := path.Match(pattern[0], name[0])
+		if !ok || err != nil {
+			return false, err
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0, nil
+}
+
 func GetDeployerType(dir string) (DeployerType, error) {
 	entries, err := os.ReadDir(dir)
 	if err != nil {
@@ -102,3 +137,16 @@ func GetDeployerType(dir string) (DeployerType, error) {
 
 	return UnknownContainerTool, nil
 }
+
+// WithGrace returns a context that outlives the parent by the grace period,
+// so that work in progress can finish when the parent is cancelled.
+func WithGrace(parent context.Context, grace time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.WithoutCancel(parent))
+	stop := context.AfterFunc(parent, func() {
+		time.AfterFunc(grace, cancel)
+	})
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
@@ -20,7 +20,13 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"smithery/forge/internal/common"
+	"smithery/forge/internal/cron"
+	"smithery/forge/internal/window"
 	"strings"
 	"time"
 
@@ -32,31 +38,298 @@ const (
 	GitlabHost = "gitlab.com"
 )
 
+const (
+	defaultEnvironment      = "production"
+	defaultStatusContext    = "forge/deploy"
+	defaultWebhookAddr      = ":8080"
+	defaultWebhookPath      = "/webhook"
+	defaultMetricsAddr      = ":9100"
+	defaultMetricsPath      = "/metrics"
+	defaultPreviewsMax      = 3
+	defaultPortRange        = 1000
+	defaultAccessTokenEnv   = "ACCESS_TOKEN"
+	defaultWebhookSecretEnv = "WEBHOOK_SECRET"
+	defaultNotifyURLEnv     = "NOTIFY_WEBHOOK_URL"
+	defaultDeployer         = "dockerfile"
+	defaultDataDir          = "~/.forge/data"
+	defaultGracePeriod      = 30   // 30 seconds
+	defaultMaxWaitFactor    = 10   // max wait relative to the settle delay
+	defaultImageInterval    = 3600 // 1 hour
+	maxPort                 = 65535
+)
+
+var projectName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// deployers maps the deployer names accepted in the config to their types
+var deployers = map[string]common.DeployerType{
+	"dockerfile": common.Dockerfile,
+}
+
+type SSHKey struct {
+	Path       string
+	Passphrase string
+	KnownHosts string
+}
+
+type SignaturePolicy struct {
+	GPGKeyring     string
+	AllowedSigners string
+}
+
+type CommitStatus struct {
+	Context   string
+	TargetURL string
+}
+
+type Deployments struct {
+	EnvironmentURL string
+}
+
+type GitHubApp struct {
+	AppID          int64
+	InstallationID int64
+	PrivateKeyPath string
+}
+
+type Previews struct {
+	Max           int
+	BasePort      int
+	PortRange     int
+	ContainerPort int
+	CloneDir      string
+	Forks         bool
+}
+
+// Debounce delays deploys until changes stop arriving; durations are in
+// seconds.
+type Debounce struct {
+	Settle  time.Duration
+	MaxWait time.Duration
+}
+
+// BaseImages configures watching the Dockerfile's base images for updates;
+// the interval is in seconds.
+type BaseImages struct {
+	Interval    time.Duration
+	RegistryURL *url.URL
+}
+
+type Webhook struct {
+	Address string
+	Path    string
+}
+
+type Metrics struct {
+	Address string
+	Path    string
+}
+
+// Notifications posts deploy and polling failures to a chat webhook.
+type Notifications struct {
+	WebhookURL *url.URL
+}
+
 type Config struct {
+	HTTPTimeout  time.Duration
+	LogOutputDir string
+	// DataDir holds the state files of the projects
+	DataDir string
+	// GracePeriod is how long deploys in progress may take to finish on
+	// shutdown
+	GracePeriod   time.Duration
+	Webhook       *Webhook
+	Metrics       *Metrics
+	Notifications *Notifications
+	Projects      []Project
+}
+
+// Project is a repository forge observes and deploys, along with everything
+// needed to do so.
+type Project struct {
+	Name             string
 	ObserverInterval time.Duration
-	HTTPTimeout      time.Duration
+	Paths            []string
+	IgnorePaths      []string
+	ScanDirectives   bool
+	Environment      string
 	Repository       *url.URL
+	APIURL           *url.URL
+	GitHubApp        *GitHubApp
+	Deployer         common.DeployerType
 	CloneDir         string
-	LogOutputDir     string
+	Branch           string
+	TagPattern       string
+	CloneDepth       int
+	Submodules       bool
+	LFS              bool
+	SSHKey           *SSHKey
+	Signature        *SignaturePolicy
+	CommitStatus     *CommitStatus
+	Deployments      *Deployments
+	Previews         *Previews
+	Schedule         *window.Schedule
+	RebuildSchedule  *cron.Schedule
+	Debounce         *Debounce
+	BaseImages       *BaseImages
 	AccessToken      string
+	WebhookSecret    string
 }
 
 type configFile struct {
 	Config struct {
-		Repository   string         `yaml:"repository_url"`
-		LogOutputDir string         `yaml:"log_output_dir"`
-		Git          gitConfig      `yaml:"git"`
-		Observer     observerConfig `yaml:"observer"`
-		HttpClient   httpConfig     `yaml:"http_client"`
+		// a single project may be configured at the top level, as before
+		// projects were supported
+		projectConfig `yaml:",inline"`
+		LogOutputDir  string          `yaml:"log_output_dir"`
+		DataDir       string          `yaml:"data_dir"`
+		GracePeriod   *int            `yaml:"shutdown_grace_period,omitempty"`
+		HttpClient    httpConfig      `yaml:"http_client"`
+		Webhook       webhookConfig   `yaml:"webhook"`
+		Metrics       metricsConfig   `yaml:"metrics,omitempty"`
+		Notifications notifyConfig    `yaml:"notifications,omitempty"`
+		Projects      []projectConfig `yaml:"projects,omitempty"`
 	} `yaml:"config"`
 }
 
+type projectConfig struct {
+	Name       string           `yaml:"name,omitempty"`
+	Repository string           `yaml:"repository_url,omitempty"`
+	APIURL     string           `yaml:"api_url,omitempty"`
+	GitHubApp  *githubAppConfig `yaml:"github_app,omitempty"`
+	// AccessTokenEnv names the environment variable holding the access token
+	AccessTokenEnv string `yaml:"access_token_env,omitempty"`
+	// WebhookSecretEnv names the environment variable holding the webhook secret
+	WebhookSecretEnv string            `yaml:"webhook_secret_env,omitempty"`
+	Deployer         string            `yaml:"deployer,omitempty"`
+	Environment      string            `yaml:"environment,omitempty"`
+	Git              gitConfig         `yaml:"git,omitempty"`
+	Observer         observerConfig    `yaml:"observer,omitempty"`
+	CommitStatus     statusConfig      `yaml:"commit_status,omitempty"`
+	Deployments      deploymentsConfig `yaml:"deployments,omitempty"`
+	Previews         previewsConfig    `yaml:"previews,omitempty"`
+	Schedule         *scheduleConfig   `yaml:"deploy_schedule,omitempty"`
+	Rebuild          *rebuildConfig    `yaml:"rebuild,omitempty"`
+	Debounce         *debounceConfig   `yaml:"debounce,omitempty"`
+	BaseImages       *baseImagesConfig `yaml:"base_images,omitempty"`
+}
+
+type githubAppConfig struct {
+	AppID          int64  `yaml:"app_id"`
+	InstallationID int64  `yaml:"installation_id,omitempty"`
+	PrivateKeyPath string `yaml:"private_key_path"`
+}
+
+type previewsConfig struct {
+	Enabled       bool   `yaml:"enabled"`
+	Max           int    `yaml:"max"`
+	BasePort      int    `yaml:"base_port"`
+	PortRange     int    `yaml:"port_range,omitempty"`
+	ContainerPort int    `yaml:"container_port"`
+	CloneDir      string `yaml:"clone_dir"`
+	// Forks allows previews of pull requests from forks
+	Forks bool `yaml:"forks,omitempty"`
+}
+
+type scheduleConfig struct {
+	// Timezone is an IANA name; windows and freezes are in local time
+	Timezone string `yaml:"timezone,omitempty"`
+	// AllowOverride lets a `[deploy now]` commit directive deploy anyway
+	AllowOverride bool           `yaml:"allow_override,omitempty"`
+	Windows       []windowConfig `yaml:"windows,omitempty"`
+	Freezes       []freezeConfig `yaml:"freezes,omitempty"`
+}
+
+type baseImagesConfig struct {
+	Interval int `yaml:"interval,omitempty"`
+	// RegistryURL replaces the registries images are resolved from
+	RegistryURL string `yaml:"registry_url,omitempty"`
+}
+
+type debounceConfig struct {
+	// Settle is how many seconds no further change has to arrive
+	Settle int `yaml:"settle"`
+	// MaxWait caps the delay in seconds; it defaults to ten times Settle
+	MaxWait int `yaml:"max_wait,omitempty"`
+}
+
+type rebuildConfig struct {
+	// Schedule is a cron expression, e.g. `0 3 * * *` for nightly rebuilds
+	Schedule string `yaml:"schedule"`
+	Timezone string `yaml:"timezone,omitempty"`
+}
+
+type windowConfig struct {
+	// Days are weekday names (`mon`, `tuesday`) or ranges (`mon-fri`)
+	Days []string `yaml:"days"`
+	From string   `yaml:"from"`
+	To   string   `yaml:"to"`
+}
+
+type freezeConfig struct {
+	From   string `yaml:"from"`
+	To     string `yaml:"to"`
+	Reason string `yaml:"reason,omitempty"`
+}
+
+type webhookConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Address string `yaml:"address"`
+	Path    string `yaml:"path"`
+}
+
+type metricsConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Address string `yaml:"address"`
+	Path    string `yaml:"path"`
+}
+
+type notifyConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// WebhookURLEnv names the environment variable holding the webhook URL,
+	// which carries its own credentials
+	WebhookURLEnv string `yaml:"webhook_url_env,omitempty"`
+}
+
+type deploymentsConfig struct {
+	Enabled        bool   `yaml:"enabled"`
+	EnvironmentURL string `yaml:"environment_url,omitempty"`
+}
+
+type statusConfig struct {
+	Enabled   bool   `yaml:"enabled"`
+	Context   string `yaml:"context"`
+	TargetURL string `yaml:"target_url,omitempty"`
+}
+
 type gitConfig struct {
-	CloneDir string `yaml:"clone_dir"`
+	CloneDir   string           `yaml:"clone_dir"`
+	Branch     string           `yaml:"branch,omitempty"`
+	TagPattern string           `yaml:"tag_pattern,omitempty"`
+	Depth      int              `yaml:"depth,omitempty"`
+	Submodules bool             `yaml:"submodules,omitempty"`
+	LFS        bool             `yaml:"lfs,omitempty"`
+	SSH        *sshConfig       `yaml:"ssh,omitempty"`
+	Signature  *signatureConfig `yaml:"signature,omitempty"`
+}
+
+type signatureConfig struct {
+	GPGKeyring     string `yaml:"gpg_keyring,omitempty"`
+	AllowedSigners string `yaml:"allowed_signers,omitempty"`
+}
+
+type sshConfig struct {
+	KeyPath    string `yaml:"key_path"`
+	Passphrase string `yaml:"passphrase,omitempty"`
+	KnownHosts string `yaml:"known_hosts"`
 }
 
 type observerConfig struct {
-	Interval int `yaml:"interval"`
+	Interval    int      `yaml:"interval"`
+	Paths       []string `yaml:"paths,omitempty"`
+	IgnorePaths []string `yaml:"ignore_paths,omitempty"`
+	// ScanDirectives logs the directives of new commits older than the head,
+	// which do not apply
+	ScanDirectives bool `yaml:"scan_directives,omitempty"`
 }
 
 type httpConfig struct {
@@ -65,20 +338,35 @@ type httpConfig struct {
 
 func configFileDefaults() *configFile {
 	cfg := configFile{}
-	cfg.Config.Repository = "https://github.com/makefolder/forge"
-	cfg.Config.Git.CloneDir = "~/.forge/clone_dir"
 	cfg.Config.LogOutputDir = "~/.forge/logs"
-	cfg.Config.Observer.Interval = 30 // 30 seconds
+	cfg.Config.DataDir = defaultDataDir
+	gracePeriod := defaultGracePeriod
+	cfg.Config.GracePeriod = &gracePeriod
 	cfg.Config.HttpClient.Timeout = 2 // 2 seconds
+	cfg.Config.Webhook.Address = defaultWebhookAddr
+	cfg.Config.Webhook.Path = defaultWebhookPath
+	cfg.Config.Metrics.Address = defaultMetricsAddr
+	cfg.Config.Metrics.Path = defaultMetricsPath
+	cfg.Config.Notifications.WebhookURLEnv = defaultNotifyURLEnv
+
+	project := projectConfig{}
+	project.Name = "forge"
+	project.Repository = "https://github.com/makefolder/forge"
+	project.Deployer = defaultDeployer
+	project.Environment = defaultEnvironment
+	project.Git.CloneDir = "~/.forge/clone_dir"
+	project.Observer.Interval = 30 // 30 seconds
+	project.CommitStatus.Context = defaultStatusContext
+	project.Previews.Max = defaultPreviewsMax
+	project.Previews.BasePort = 20000
+	project.Previews.ContainerPort = 80
+	project.Previews.CloneDir = "~/.forge/previews"
+	cfg.Config.Projects = []projectConfig{project}
 	return &cfg
 }
 
 func MustParse(dir string) *Config {
 	var cfg configFile
-	accessToken := os.Getenv("ACCESS_TOKEN")
-	if len(accessToken) == 0 {
-		panic("No git access token provided (ACCESS_TOKEN environment variable)")
-	}
 
 	file, err := os.ReadFile(dir)
 	if err != nil {
@@ -93,7 +381,145 @@ func MustParse(dir string) *Config {
 		panic("Invalid log output directory")
 	}
 
-	repo, err := url.Parse(cfg.Config.Repository)
+	if cfg.Config.HttpClient.Timeout == 0 {
+		panic("Invalid http client timeout")
+	}
+
+	gracePeriod := defaultGracePeriod
+	if cfg.Config.GracePeriod != nil {
+		gracePeriod = *cfg.Config.GracePeriod
+	}
+	if gracePeriod < 0 {
+		panic("Invalid shutdown grace period")
+	}
+
+	var webhook *Webhook
+	if hook := cfg.Config.Webhook; hook.Enabled {
+		if hook.Address == "" {
+			hook.Address = defaultWebhookAddr
+		}
+		if hook.Path == "" {
+			hook.Path = defaultWebhookPath
+		}
+		if !strings.HasPrefix(hook.Path, "/") {
+			panic("Invalid webhook path (must start with `/`)")
+		}
+		webhook = &Webhook{
+			Address: hook.Address,
+			Path:    hook.Path,
+		}
+	}
+
+	var metrics *Metrics
+	if m := cfg.Config.Metrics; m.Enabled {
+		if m.Address == "" {
+			m.Address = defaultMetricsAddr
+		}
+		if m.Path == "" {
+			m.Path = defaultMetricsPath
+		}
+		if !strings.HasPrefix(m.Path, "/") {
+			panic("Invalid metrics path (must start with `/`)")
+		}
+		if webhook != nil && webhook.Address == m.Address {
+			panic("Metrics and webhook servers cannot share an address")
+		}
+		metrics = &Metrics{
+			Address: m.Address,
+			Path:    m.Path,
+		}
+	}
+
+	var notifications *Notifications
+	if notify := cfg.Config.Notifications; notify.Enabled {
+		if notify.WebhookURLEnv == "" {
+			notify.WebhookURLEnv = defaultNotifyURLEnv
+		}
+		raw := os.Getenv(notify.WebhookURLEnv)
+		if raw == "" {
+			panic(fmt.Sprintf("No notification webhook URL provided (%s environment variable)", notify.WebhookURLEnv))
+		}
+		webhookURL, err := url.Parse(raw)
+		if err != nil || (webhookURL.Scheme != "http" && webhookURL.Scheme != "https") {
+			panic(fmt.Sprintf("Invalid notification webhook URL (%s environment variable)", notify.WebhookURLEnv))
+		}
+		notifications = &Notifications{WebhookURL: webhookURL}
+	}
+
+	files := cfg.Config.Projects
+	if len(files) == 0 {
+		files = []projectConfig{cfg.Config.projectConfig}
+	} else if cfg.Config.Repository != "" {
+		panic("Only one of repository_url or projects can be set")
+	}
+
+	var projects []Project
+	for _, file := range files {
+		project := mustParseProject(file, webhook != nil)
+		if p := project.Previews; p != nil && nested(p.CloneDir, project.CloneDir) {
+			panic(fmt.Sprintf("Project %s has overlapping clone and previews directories", project.Name))
+		}
+		for _, other := range projects {
+			if other.Name == project.Name {
+				panic(fmt.Sprintf("Duplicate project name (%s)", project.Name))
+			}
+			for _, dir := range cloneDirs(project) {
+				for _, otherDir := range cloneDirs(other) {
+					if nested(dir, otherDir) {
+						panic(fmt.Sprintf("Projects %s and %s have overlapping clone directories", other.Name, project.Name))
+					}
+				}
+			}
+			if a, b := other.Previews, project.Previews; a != nil && b != nil &&
+				a.BasePort < b.BasePort+b.PortRange && b.BasePort < a.BasePort+a.PortRange {
+				panic(fmt.Sprintf("Projects %s and %s have overlapping previews port ranges", other.Name, project.Name))
+			}
+		}
+		projects = append(projects, project)
+	}
+
+	cfg.Config.LogOutputDir = strings.TrimRight(cfg.Config.LogOutputDir, "/")
+	if strings.HasPrefix(cfg.Config.LogOutputDir, "~") {
+		cfg.Config.LogOutputDir = expandTilde(cfg.Config.LogOutputDir)
+	}
+
+	// configs written before state was persisted have no data dir
+	if cfg.Config.DataDir == "" {
+		cfg.Config.DataDir = defaultDataDir
+	}
+	cfg.Config.DataDir = expandPath(strings.TrimRight(cfg.Config.DataDir, "/"))
+
+	return &Config{
+		HTTPTimeout:   time.Duration(cfg.Config.HttpClient.Timeout),
+		LogOutputDir:  cfg.Config.LogOutputDir,
+		DataDir:       cfg.Config.DataDir,
+		GracePeriod:   time.Duration(gracePeriod),
+		Webhook:       webhook,
+		Metrics:       metrics,
+		Notifications: notifications,
+		Projects:      projects,
+	}
+}
+
+// cloneDirs returns the directories the project clones into.
+func cloneDirs(p Project) []string {
+	dirs := []string{p.CloneDir}
+	if p.Previews != nil {
+		dirs = append(dirs, p.Previews.CloneDir)
+	}
+	return dirs
+}
+
+// nested reports whether the directories are the same or one contains the
+// other.
+func nested(a, b string) bool {
+	a, b = filepath.Clean(a), filepath.Clean(b)
+	return a == b || strings.HasPrefix(a, b+string(filepath.Separator)) ||
+		strings.HasPrefix(b, a+string(filepath.Separator))
+}
+
+func mustParseProject(cfg projectConfig, webhook bool) Project {
+	repo, err := url.Parse(cfg.Repository)
 	if err != nil || repo == nil {
 		panic(fmt.Errorf("Failed to parse repository URL: %w", err))
 	}
@@ -102,6 +528,48 @@ func MustParse(dir string) *Config {
 		panic("Invalid repo URL")
 	}
 
+	if cfg.Name == "" {
+		cfg.Name = path.Base(strings.TrimSuffix(repo.Path, ".git"))
+	}
+
+	// the project is named in any panic below
+	defer func() {
+		if r := recover(); r != nil {
+			panic(fmt.Sprintf("Invalid project %s: %v", cfg.Name, r))
+		}
+	}()
+
+	// the name is used for file names
+	if !projectName.MatchString(cfg.Name) {
+		panic("Invalid project name (letters, digits, `.`, `_` and `-` only)")
+	}
+
+	if cfg.AccessTokenEnv == "" {
+		cfg.AccessTokenEnv = defaultAccessTokenEnv
+	}
+	accessToken := os.Getenv(cfg.AccessTokenEnv)
+
+	// with a deploy key, the token is only needed for API calls to private
+	// repositories and may be omitted; a GitHub App mints its own tokens
+	if len(accessToken) == 0 && cfg.Git.SSH == nil && cfg.GitHubApp == nil {
+		panic(fmt.Sprintf("No git access token provided (%s environment variable)", cfg.AccessTokenEnv))
+	}
+
+	var webhookSecret string
+	if webhook {
+		if cfg.WebhookSecretEnv == "" {
+			cfg.WebhookSecretEnv = defaultWebhookSecretEnv
+		}
+		webhookSecret = os.Getenv(cfg.WebhookSecretEnv)
+		if webhookSecret == "" {
+			panic(fmt.Sprintf("No webhook secret provided (%s environment variable)", cfg.WebhookSecretEnv))
+		}
+	}
+
+	if cfg.Environment == "" {
+		cfg.Environment = defaultEnvironment
+	}
+
 	switch repo.Hostname() {
 	case GithubHost:
 	case GitlabHost:
@@ -109,36 +577,242 @@ func MustParse(dir string) *Config {
 		panic("Invalid git host (supported: `github.com` or `gitlab.com`)")
 	}
 
-	if cfg.Config.Git.CloneDir == "" {
+	var apiURL *url.URL
+	if cfg.APIURL != "" {
+		apiURL, err = url.Parse(cfg.APIURL)
+		if err != nil || apiURL.Scheme == "" || apiURL.Host == "" {
+			panic(fmt.Errorf("Invalid API URL (%s)", cfg.APIURL))
+		}
+	}
+
+	var githubApp *GitHubApp
+	if app := cfg.GitHubApp; app != nil {
+		if repo.Hostname() != GithubHost {
+			panic("GitHub App authentication is only supported for `github.com` repositories")
+		}
+		if app.AppID <= 0 {
+			panic("Invalid GitHub App ID")
+		}
+		if app.PrivateKeyPath == "" {
+			panic("Invalid GitHub App private key path")
+		}
+		githubApp = &GitHubApp{
+			AppID:          app.AppID,
+			InstallationID: app.InstallationID,
+			PrivateKeyPath: expandPath(app.PrivateKeyPath),
+		}
+	}
+
+	if cfg.Deployer == "" {
+		cfg.Deployer = defaultDeployer
+	}
+	deployer, ok := deployers[strings.ToLower(cfg.Deployer)]
+	if !ok {
+		panic(fmt.Sprintf("Unsupported deployer (%s)", cfg.Deployer))
+	}
+
+	if cfg.Git.CloneDir == "" {
 		panic("Invalid git clone directory")
 	}
 
-	if cfg.Config.Observer.Interval == 0 {
+	if cfg.Git.Branch != "" && cfg.Git.TagPattern != "" {
+		panic("Only one of git branch or tag pattern can be set")
+	}
+
+	if _, err := path.Match(cfg.Git.TagPattern, ""); err != nil {
+		panic(fmt.Errorf("Invalid git tag pattern: %w", err))
+	}
+
+	if cfg.Git.Depth < 0 {
+		panic("Invalid git clone depth")
+	}
+
+	var sshKey *SSHKey
+	if ssh := cfg.Git.SSH; ssh != nil {
+		if ssh.KeyPath == "" {
+			panic("Invalid git ssh key path")
+		}
+		if ssh.KnownHosts == "" {
+			panic("Invalid git ssh known hosts path (host keys are always verified)")
+		}
+		// the LFS batch API is only reached over HTTPS
+		if cfg.Git.LFS && len(accessToken) == 0 && cfg.GitHubApp == nil {
+			panic(fmt.Sprintf("Git LFS over ssh needs an access token (%s environment variable)", cfg.AccessTokenEnv))
+		}
+		sshKey = &SSHKey{
+			Path:       expandPath(ssh.KeyPath),
+			Passphrase: ssh.Passphrase,
+			KnownHosts: expandPath(ssh.KnownHosts),
+		}
+	}
+
+	var signature *SignaturePolicy
+	if sig := cfg.Git.Signature; sig != nil {
+		if sig.GPGKeyring == "" && sig.AllowedSigners == "" {
+			panic("Invalid git signature policy (no gpg keyring or allowed signers file)")
+		}
+		signature = &SignaturePolicy{
+			GPGKeyring:     expandPath(sig.GPGKeyring),
+			AllowedSigners: expandPath(sig.AllowedSigners),
+		}
+	}
+
+	if cfg.Observer.Interval == 0 {
 		panic("Invalid observer interval")
 	}
 
-	if cfg.Config.HttpClient.Timeout == 0 {
-		panic("Invalid http client timeout")
+	for _, pattern := range slices.Concat(cfg.Observer.Paths, cfg.Observer.IgnorePaths) {
+		for segment := range strings.SplitSeq(pattern, "/") {
+			if _, err := path.Match(segment, ""); err != nil {
+				panic(fmt.Errorf("Invalid observer path pattern (%s): %w", pattern, err))
+			}
+		}
 	}
 
-	cfg.Config.Git.CloneDir = strings.TrimRight(cfg.Config.Git.CloneDir, "/")
-	if strings.HasPrefix(cfg.Config.Git.CloneDir, "~") {
-		cfg.Config.Git.CloneDir = expandTilde(cfg.Config.Git.CloneDir)
+	var commitStatus *CommitStatus
+	if status := cfg.CommitStatus; status.Enabled {
+		if status.Context == "" {
+			status.Context = defaultStatusContext
+		}
+		commitStatus = &CommitStatus{
+			Context:   status.Context,
+			TargetURL: status.TargetURL,
+		}
 	}
 
-	cfg.Config.LogOutputDir = strings.TrimRight(cfg.Config.LogOutputDir, "/")
-	if strings.HasPrefix(cfg.Config.LogOutputDir, "~") {
-		cfg.Config.LogOutputDir = expandTilde(cfg.Config.LogOutputDir)
+	var deployments *Deployments
+	if cfg.Deployments.Enabled {
+		deployments = &Deployments{
+			EnvironmentURL: cfg.Deployments.EnvironmentURL,
+		}
 	}
 
-	return &Config{
-		ObserverInterval: time.Duration(cfg.Config.Observer.Interval),
-		HTTPTimeout:      time.Duration(cfg.Config.HttpClient.Timeout),
-		CloneDir:         cfg.Config.Git.CloneDir,
-		LogOutputDir:     cfg.Config.LogOutputDir,
+	var previews *Previews
+	if pv := cfg.Previews; pv.Enabled {
+		if pv.Max == 0 {
+			pv.Max = defaultPreviewsMax
+		}
+		if pv.Max < 0 {
+			panic("Invalid previews max")
+		}
+		if pv.BasePort <= 0 || pv.BasePort > maxPort {
+			panic("Invalid previews base port")
+		}
+		if pv.PortRange == 0 {
+			pv.PortRange = defaultPortRange
+		}
+		if pv.PortRange < pv.Max || pv.BasePort+pv.PortRange-1 > maxPort {
+			panic("Invalid previews port range (fewer ports than max, or beyond 65535)")
+		}
+		if pv.ContainerPort <= 0 || pv.ContainerPort > maxPort {
+			panic("Invalid previews container port")
+		}
+		if pv.CloneDir == "" {
+			panic("Invalid previews clone directory")
+		}
+		previews = &Previews{
+			Max:           pv.Max,
+			BasePort:      pv.BasePort,
+			PortRange:     pv.PortRange,
+			ContainerPort: pv.ContainerPort,
+			CloneDir:      expandPath(strings.TrimRight(pv.CloneDir, "/")),
+			Forks:         pv.Forks,
+		}
+	}
+
+	var schedule *window.Schedule
+	if cfg.Schedule != nil {
+		schedule = mustParseSchedule(*cfg.Schedule)
+	}
+
+	var rebuildSchedule *cron.Schedule
+	if rb := cfg.Rebuild; rb != nil {
+		loc := time.UTC
+		if rb.Timezone != "" {
+			if loc, err = time.LoadLocation(rb.Timezone); err != nil {
+				panic(fmt.Errorf("Invalid rebuild timezone (%s): %w", rb.Timezone, err))
+			}
+		}
+		if rebuildSchedule, err = cron.Parse(rb.Schedule, loc); err != nil {
+			panic(fmt.Errorf("Invalid rebuild schedule: %w", err))
+		}
+	}
+
+	var debounce *Debounce
+	if db := cfg.Debounce; db != nil {
+		if db.Settle <= 0 {
+			panic("Invalid debounce settle delay")
+		}
+		if db.MaxWait == 0 {
+			db.MaxWait = db.Settle * defaultMaxWaitFactor
+		}
+		if db.MaxWait < db.Settle {
+			panic("Invalid debounce max wait (shorter than the settle delay)")
+		}
+		debounce = &Debounce{
+			Settle:  time.Duration(db.Settle),
+			MaxWait: time.Duration(db.MaxWait),
+		}
+	}
+
+	var baseImages *BaseImages
+	if bi := cfg.BaseImages; bi != nil {
+		if bi.Interval == 0 {
+			bi.Interval = defaultImageInterval
+		}
+		if bi.Interval < 0 {
+			panic("Invalid base images interval")
+		}
+		baseImages = &BaseImages{Interval: time.Duration(bi.Interval)}
+		if bi.RegistryURL != "" {
+			baseImages.RegistryURL, err = url.Parse(bi.RegistryURL)
+			if err != nil || baseImages.RegistryURL.Scheme == "" || baseImages.RegistryURL.Host == "" {
+				panic(fmt.Errorf("Invalid base images registry URL (%s)", bi.RegistryURL))
+			}
+		}
+	}
+
+	cfg.Git.CloneDir = strings.TrimRight(cfg.Git.CloneDir, "/")
+	if strings.HasPrefix(cfg.Git.CloneDir, "~") {
+		cfg.Git.CloneDir = expandTilde(cfg.Git.CloneDir)
+	}
+
+	return Project{
+		Name:             cfg.Name,
+		ObserverInterval: time.Duration(cfg.Observer.Interval),
+		Paths:            cfg.Observer.Paths,
+		IgnorePaths:      cfg.Observer.IgnorePaths,
+		ScanDirectives:   cfg.Observer.ScanDirectives,
+		Environment:      cfg.Environment,
 		Repository:       repo,
+		APIURL:           apiURL,
+		GitHubApp:        githubApp,
+		Deployer:         deployer,
+		CloneDir:         cfg.Git.CloneDir,
+		Branch:           cfg.Git.Branch,
+		TagPattern:       cfg.Git.TagPattern,
+		CloneDepth:       cfg.Git.Depth,
+		Submodules:       cfg.Git.Submodules,
+		LFS:              cfg.Git.LFS,
+		SSHKey:           sshKey,
+		Signature:        signature,
+		CommitStatus:     commitStatus,
+		Deployments:      deployments,
+		Previews:         previews,
+		Schedule:         schedule,
+		RebuildSchedule:  rebuildSchedule,
+		Debounce:         debounce,
+		BaseImages:       baseImages,
 		AccessToken:      accessToken,
+		WebhookSecret:    webhookSecret,
+	}
+}
+
+func expandPath(path string) string {
+	if strings.HasPrefix(path, "~") {
+		return expandTilde(path)
 	}
+	return path
 }
 
 func expandTilde(path string) string {
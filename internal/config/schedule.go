@@ -0,0 +1,139 @@
+// Forge - Automated Docker container deployment tool for VPS environments.
+// Monitors Git repositories and redeploys containers on new commits.
+// Copyright (C) 2025 Artemii Fedotov
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+package config
+
+import (
+	"fmt"
+	"slices"
+	"smithery/forge/internal/window"
+	"strings"
+	"time"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// freezeLayouts are the accepted forms of freeze bounds, in local time
+var freezeLayouts = []string{"2006-01-02 15:04", time.DateOnly}
+
+func mustParseSchedule(cfg scheduleConfig) *window.Schedule {
+	loc := time.UTC
+	if cfg.Timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(cfg.Timezone); err != nil {
+			panic(fmt.Errorf("Invalid deploy schedule timezone (%s): %w", cfg.Timezone, err))
+		}
+	}
+
+	if len(cfg.Windows) == 0 && len(cfg.Freezes) == 0 {
+		panic("Invalid deploy schedule (no windows or freezes)")
+	}
+
+	schedule := &window.Schedule{
+		Location:      loc,
+		AllowOverride: cfg.AllowOverride,
+	}
+	for _, w := range cfg.Windows {
+		win := window.Window{
+			From: mustParseClock(w.From),
+			To:   mustParseClock(w.To),
+		}
+		if len(w.Days) == 0 {
+			panic("Invalid deploy window (no days)")
+		}
+		for _, day := range w.Days {
+			for _, d := range mustParseDays(day) {
+				if !slices.Contains(win.Days, d) {
+					win.Days = append(win.Days, d)
+				}
+			}
+		}
+		schedule.Windows = append(schedule.Windows, win)
+	}
+
+	for _, f := range cfg.Freezes {
+		from, _ := mustParseFreezeTime(f.From, loc)
+		to, dateOnly := mustParseFreezeTime(f.To, loc)
+		// a freeze to a date lasts the whole of that day
+		if dateOnly {
+			to = to.AddDate(0, 0, 1)
+		}
+		freeze := window.Freeze{From: from, To: to, Reason: f.Reason}
+		if !freeze.To.After(freeze.From) {
+			panic(fmt.Sprintf("Invalid freeze (%s - %s ends before it starts)", f.From, f.To))
+		}
+		schedule.Freezes = append(schedule.Freezes, freeze)
+	}
+	return schedule
+}
+
+// mustParseClock parses a time of day such as `09:30`; `24:00` is the end
+// of the day.
+func mustParseClock(clock string) time.Duration {
+	var hour, minute int
+	if _, err := fmt.Sscanf(clock, "%d:%d", &hour, &minute); err != nil ||
+		hour < 0 || minute < 0 || minute > 59 || hour > 24 || (hour == 24 && minute != 0) {
+		panic(fmt.Sprintf("Invalid deploy window time (%s); expected HH:MM", clock))
+	}
+	return time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute
+}
+
+// mustParseDays parses a weekday or a range of them, which may wrap around
+// the week (`fri-mon`).
+func mustParseDays(days string) []time.Weekday {
+	first, last, isRange := strings.Cut(days, "-")
+	from := mustParseDay(first)
+	if !isRange {
+		return []time.Weekday{from}
+	}
+
+	to := mustParseDay(last)
+	result := []time.Weekday{from}
+	for d := from; d != to; {
+		d = (d + 1) % 7
+		result = append(result, d)
+	}
+	return result
+}
+
+func mustParseDay(day string) time.Weekday {
+	day = strings.ToLower(strings.TrimSpace(day))
+	if len(day) >= 3 {
+		if d, ok := weekdays[day[:3]]; ok && strings.HasPrefix(strings.ToLower(d.String()), day) {
+			return d
+		}
+	}
+	panic(fmt.Sprintf("Invalid deploy window day (%s)", day))
+}
+
+// mustParseFreezeTime parses a freeze bound and reports whether it is only
+// a date.
+func mustParseFreezeTime(value string, loc *time.Location) (time.Time, bool) {
+	for _, layout := range freezeLayouts {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, layout == time.DateOnly
+		}
+	}
+	panic(fmt.Sprintf("Invalid freeze time (%s); expected YYYY-MM-DD or YYYY-MM-DD HH:MM", value))
+}
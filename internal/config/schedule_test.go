@@ -0,0 +1,178 @@
+// Forge - Automated Docker container deployment tool for VPS environments.
+// Monitors Git repositories and redeploys containers on new commits.
+// Copyright (C) 2025 Artemii Fedotov
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+package config
+
+import (
+	"slices"
+	"smithery/forge/internal/window"
+	"testing"
+	"time"
+)
+
+// panics reports whether calling f panics
+func panics(f func()) (panicked bool) {
+	defer func() { panicked = recover() != nil }()
+	f()
+	return false
+}
+
+func TestMustParseClock(t *testing.T) {
+	tests := []struct {
+		clock   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{clock: "00:00", want: 0},
+		{clock: "09:30", want: 9*time.Hour + 30*time.Minute},
+		{clock: "23:59", want: 23*time.Hour + 59*time.Minute},
+		{clock: "24:00", want: 24 * time.Hour},
+		{clock: "24:01", wantErr: true},
+		{clock: "25:00", wantErr: true},
+		{clock: "12:60", wantErr: true},
+		{clock: "-1:00", wantErr: true},
+		{clock: "noon", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.clock, func(t *testing.T) {
+			var got time.Duration
+			if panicked := panics(func() { got = mustParseClock(tt.clock) }); panicked != tt.wantErr {
+				t.Fatalf("mustParseClock(%q) panicked = %v, want %v", tt.clock, panicked, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("mustParseClock(%q) = %s, want %s", tt.clock, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMustParseDays(t *testing.T) {
+	tests := []struct {
+		days    string
+		want    []time.Weekday
+		wantErr bool
+	}{
+		{days: "mon", want: []time.Weekday{time.Monday}},
+		{days: "Tuesday", want: []time.Weekday{time.Tuesday}},
+		{days: "mon-fri", want: []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}},
+		{days: "fri-mon", want: []time.Weekday{time.Friday, time.Saturday, time.Sunday, time.Monday}},
+		{days: "sat-sun", want: []time.Weekday{time.Saturday, time.Sunday}},
+		{days: "wed-wed", want: []time.Weekday{time.Wednesday}},
+		{days: "mo", wantErr: true},
+		{days: "monkey", wantErr: true},
+		{days: "mon-", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.days, func(t *testing.T) {
+			var got []time.Weekday
+			if panicked := panics(func() { got = mustParseDays(tt.days) }); panicked != tt.wantErr {
+				t.Fatalf("mustParseDays(%q) panicked = %v, want %v", tt.days, panicked, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("mustParseDays(%q) = %v, want %v", tt.days, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMustParseScheduleFreezes(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("no timezone data: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		from, to string
+		wantFrom time.Time
+		wantTo   time.Time
+		wantErr  bool
+	}{
+		{
+			name:     "date-only end is inclusive",
+			from:     "2026-12-20",
+			to:       "2026-12-31",
+			wantFrom: time.Date(2026, 12, 20, 0, 0, 0, 0, loc),
+			wantTo:   time.Date(2027, 1, 1, 0, 0, 0, 0, loc),
+		},
+		{
+			name:     "single day",
+			from:     "2026-10-25",
+			to:       "2026-10-25",
+			wantFrom: time.Date(2026, 10, 25, 0, 0, 0, 0, loc),
+			wantTo:   time.Date(2026, 10, 26, 0, 0, 0, 0, loc),
+		},
+		{
+			name:     "times are exact",
+			from:     "2026-12-20 18:00",
+			to:       "2026-12-31 12:30",
+			wantFrom: time.Date(2026, 12, 20, 18, 0, 0, 0, loc),
+			wantTo:   time.Date(2026, 12, 31, 12, 30, 0, 0, loc),
+		},
+		{name: "ends before it starts", from: "2026-12-31", to: "2026-12-20", wantErr: true},
+		{name: "ends when it starts", from: "2026-12-20 10:00", to: "2026-12-20 10:00", wantErr: true},
+		{name: "not a date", from: "christmas", to: "2026-12-31", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var schedule *window.Schedule
+			panicked := panics(func() {
+				schedule = mustParseSchedule(scheduleConfig{
+					Timezone: "Europe/Berlin",
+					Freezes:  []freezeConfig{{From: tt.from, To: tt.to}},
+				})
+			})
+			if panicked != tt.wantErr {
+				t.Fatalf("mustParseSchedule() panicked = %v, want %v", panicked, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			freeze := schedule.Freezes[0]
+			if !freeze.From.Equal(tt.wantFrom) || !freeze.To.Equal(tt.wantTo) {
+				t.Errorf("freeze = %s - %s, want %s - %s", freeze.From, freeze.To, tt.wantFrom, tt.wantTo)
+			}
+		})
+	}
+}
+
+func TestMustParseSchedule(t *testing.T) {
+	schedule := mustParseSchedule(scheduleConfig{
+		Windows: []windowConfig{{Days: []string{"fri-mon", "sun"}, From: "22:00", To: "02:00"}},
+	})
+	if schedule.Location != time.UTC {
+		t.Errorf("location = %s, want UTC", schedule.Location)
+	}
+
+	want := window.Window{
+		Days: []time.Weekday{time.Friday, time.Saturday, time.Sunday, time.Monday},
+		From: 22 * time.Hour,
+		To:   2 * time.Hour,
+	}
+	if got := schedule.Windows[0]; !slices.Equal(got.Days, want.Days) || got.From != want.From || got.To != want.To {
+		t.Errorf("window = %+v, want %+v", got, want)
+	}
+
+	for name, cfg := range map[string]scheduleConfig{
+		"empty":        {},
+		"no days":      {Windows: []windowConfig{{From: "09:00", To: "17:00"}}},
+		"bad timezone": {Timezone: "Mars/Olympus", Windows: []windowConfig{{Days: []string{"mon"}, From: "09:00", To: "17:00"}}},
+	} {
+		if !panics(func() { mustParseSchedule(cfg) }) {
+			t.Errorf("mustParseSchedule() of %s config did not panic", name)
+		}
+	}
+}
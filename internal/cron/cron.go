@@ -0,0 +1,195 @@
+// Forge - Automated Docker container deployment tool for VPS environments.
+// Monitors Git repositories and redeploys containers on new commits.
+// Copyright (C) 2025 Artemii Fedotov
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+package cron
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidExpression = errors.New("invalid cron expression")
+
+// descriptors are the shorthands accepted in place of the five fields
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// maxYears bounds the search for the next activation, so that expressions
+// that never match (`0 0 30 2 *`) do not loop forever
+const maxYears = 5
+
+// Schedule is a parsed cron expression. Fields are bit sets of the values
+// they match.
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	// restricted day fields match if either does, as in Vixie cron
+	domAny, dowAny bool
+	location       *time.Location
+	expr           string
+}
+
+type field struct {
+	min, max int
+}
+
+var (
+	minutes = field{0, 59}
+	hours   = field{0, 23}
+	days    = field{1, 31}
+	months  = field{1, 12}
+	// 7 is accepted for Sunday as well
+	weekdays = field{0, 7}
+)
+
+// Parse parses a standard five field expression (minute, hour, day of
+// month, month, day of week) or a descriptor such as `@daily`, evaluated in
+// the location.
+func Parse(expr string, location *time.Location) (*Schedule, error) {
+	if d, ok := descriptors[strings.ToLower(strings.TrimSpace(expr))]; ok {
+		expr = d
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("%w (%s): expected 5 fields", ErrInvalidExpression, expr)
+	}
+
+	s := &Schedule{location: location, expr: expr}
+	var err error
+	for i, target := range []struct {
+		bits *uint64
+		f    field
+	}{
+		{&s.minute, minutes},
+		{&s.hour, hours},
+		{&s.dom, days},
+		{&s.month, months},
+		{&s.dow, weekdays},
+	} {
+		if *target.bits, err = parseField(fields[i], target.f); err != nil {
+			return nil, fmt.Errorf("%w (%s): %w", ErrInvalidExpression, expr, err)
+		}
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domAny = fields[2] == "*"
+	s.dowAny = fields[4] == "*"
+	return s, nil
+}
+
+// parseField parses a comma separated list of values, ranges (`1-5`) and
+// steps (`*/15`, `10-50/20`).
+func parseField(value string, f field) (uint64, error) {
+	var set uint64
+	for part := range strings.SplitSeq(value, ",") {
+		rng, step, hasStep := strings.Cut(part, "/")
+
+		from, to := f.min, f.max
+		if rng != "*" {
+			first, last, isRange := strings.Cut(rng, "-")
+			var err error
+			if from, err = parseValue(first, f); err != nil {
+				return 0, err
+			}
+			to = from
+			if isRange {
+				if to, err = parseValue(last, f); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				to = f.max
+			}
+		}
+		if from > to {
+			return 0, fmt.Errorf("range %s is reversed", rng)
+		}
+
+		n := 1
+		if hasStep {
+			var err error
+			if n, err = strconv.Atoi(step); err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step %s", step)
+			}
+		}
+		for v := from; v <= to; v += n {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+func parseValue(value string, f field) (int, error) {
+	v, err := strconv.Atoi(value)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("value %s is out of range %d-%d", value, f.min, f.max)
+	}
+	return v, nil
+}
+
+// Next returns the first activation after t, or the zero time if there is
+// none in the next years.
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.In(s.location).Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(maxYears, 0, 0)
+
+	for t.Before(limit) {
+		switch {
+		case !has(s.month, int(t.Month())):
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, s.location)
+		case !s.matchDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, s.location)
+		case !has(s.hour, t.Hour()):
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, s.location)
+		case !has(s.minute, t.Minute()):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (s *Schedule) matchDay(t time.Time) bool {
+	dom, dow := has(s.dom, t.Day()), has(s.dow, int(t.Weekday()))
+	switch {
+	case s.domAny && s.dowAny:
+		return true
+	case s.domAny:
+		return dow
+	case s.dowAny:
+		return dom
+	}
+	return dom || dow
+}
+
+func has(set uint64, v int) bool {
+	return set&(1<<v) != 0
+}
+
+func (s *Schedule) String() string {
+	return s.expr
+}
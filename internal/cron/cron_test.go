@@ -0,0 +1,136 @@
+// Forge - Automated Docker container deployment tool for VPS environments.
+// Monitors Git repositories and redeploys containers on new commits.
+// Copyright (C) 2025 Artemii Fedotov
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+package cron
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr bool
+	}{
+		{expr: "* * * * *"},
+		{expr: "*/15 9-17 * * mon", wantErr: true},
+		{expr: "*/15 9-17 * * 1-5"},
+		{expr: "0,30 0 1,15 */3 0"},
+		{expr: "10-50/20 * * * 7"},
+		{expr: "@daily"},
+		{expr: " @Weekly "},
+		{expr: "0 0 30 2 *"},
+		{expr: "* * * *", wantErr: true},
+		{expr: "* * * * * *", wantErr: true},
+		{expr: "60 * * * *", wantErr: true},
+		{expr: "* 24 * * *", wantErr: true},
+		{expr: "* * 0 * *", wantErr: true},
+		{expr: "* * * 13 *", wantErr: true},
+		{expr: "* * * * 8", wantErr: true},
+		{expr: "5-1 * * * *", wantErr: true},
+		{expr: "*/0 * * * *", wantErr: true},
+		{expr: "@sometimes", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := Parse(tt.expr, time.UTC)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidExpression) {
+				t.Errorf("Parse() error = %v, want ErrInvalidExpression", err)
+			}
+		})
+	}
+}
+
+func TestNext(t *testing.T) {
+	date := func(year int, month time.Month, day, hour, minute int) time.Time {
+		return time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+	}
+	// 18 October 2026 is a Sunday
+	now := date(2026, 10, 18, 10, 17)
+
+	tests := []struct {
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"* * * * *", now, date(2026, 10, 18, 10, 18)},
+		{"* * * * *", now.Add(30 * time.Second), date(2026, 10, 18, 10, 18)},
+		{"*/15 * * * *", now, date(2026, 10, 18, 10, 30)},
+		{"17 10 * * *", now, date(2026, 10, 19, 10, 17)},
+		{"@hourly", now, date(2026, 10, 18, 11, 0)},
+		{"@daily", now, date(2026, 10, 19, 0, 0)},
+		{"@weekly", now, date(2026, 10, 25, 0, 0)},
+		{"@monthly", now, date(2026, 11, 1, 0, 0)},
+		{"@yearly", now, date(2027, 1, 1, 0, 0)},
+		{"0 3 * * 1-5", now, date(2026, 10, 19, 3, 0)},
+		{"0 3 * * 6", now, date(2026, 10, 24, 3, 0)},
+		{"0 3 * * 7", now, date(2026, 10, 25, 3, 0)},
+		{"0 0 31 * *", now, date(2026, 10, 31, 0, 0)},
+		{"0 0 31 * *", date(2026, 10, 31, 0, 0), date(2026, 12, 31, 0, 0)},
+		{"0 0 29 2 *", now, date(2028, 2, 29, 0, 0)},
+		{"0 0 1 1 *", date(2026, 12, 31, 23, 59), date(2027, 1, 1, 0, 0)},
+		// restricted day of month and weekday match if either does
+		{"0 0 1 * 1", now, date(2026, 10, 19, 0, 0)},
+		{"0 0 1 * 1", date(2026, 10, 26, 12, 0), date(2026, 11, 1, 0, 0)},
+		// a wildcard day of month leaves the weekday to decide, and the other way round
+		{"0 0 * * 3", now, date(2026, 10, 21, 0, 0)},
+		{"0 0 20 * *", now, date(2026, 10, 20, 0, 0)},
+		// never matches
+		{"0 0 30 2 *", now, time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			s, err := Parse(tt.expr, time.UTC)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := s.Next(tt.from); !got.Equal(tt.want) {
+				t.Errorf("Next(%s) = %s, want %s", tt.from, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextLocation(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("no timezone data: %v", err)
+	}
+	s, err := Parse("0 4 * * *", loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		from time.Time
+		want time.Time
+	}{
+		// 04:00 in Berlin, before and after the clocks go forward
+		{time.Date(2026, 3, 28, 12, 0, 0, 0, time.UTC), time.Date(2026, 3, 29, 2, 0, 0, 0, time.UTC)},
+		{time.Date(2026, 3, 29, 12, 0, 0, 0, time.UTC), time.Date(2026, 3, 30, 2, 0, 0, 0, time.UTC)},
+		{time.Date(2026, 3, 27, 12, 0, 0, 0, time.UTC), time.Date(2026, 3, 28, 3, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		if got := s.Next(tt.from); !got.Equal(tt.want) {
+			t.Errorf("Next(%s) = %s, want %s", tt.from, got, tt.want)
+		}
+	}
+}
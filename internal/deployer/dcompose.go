@@ -27,3 +27,15 @@ func NewDockerComposeDeployer() IDeployer {
 func (dc *DockerComposeDeployer) Deploy(ctx context.Context, params DeployParams) error {
 	return nil
 }
+
+func (dc *DockerComposeDeployer) Revision(ctx context.Context, containerName string) (string, error) {
+	return "", nil
+}
+
+func (dc *DockerComposeDeployer) Remove(ctx context.Context, containerName string) error {
+	return nil
+}
+
+func (dc *DockerComposeDeployer) Deployed(ctx context.Context, label string) (map[string]string, error) {
+	return nil, nil
+}
@@ -22,58 +22,258 @@ import (
 	"log/slog"
 	"smithery/forge/internal/clients/git"
 	"smithery/forge/internal/common"
+	"smithery/forge/internal/events"
+	"smithery/forge/internal/state"
+	"time"
 )
 
-var ErrDockerfileNotExist = errors.New("dockerfile is not in the project's root directory")
+// RevisionLabel is the image and container label holding the deployed commit SHA
+const RevisionLabel = "forge.revision"
+
+var (
+	ErrDockerfileNotExist = errors.New("dockerfile is not in the project's root directory")
+	// ErrRolledBack wraps the error of a deploy that was undone by bringing
+	// the previous container back
+	ErrRolledBack  = errors.New("rolled back to the previous container")
+	errInterrupted = errors.New("deploy was interrupted")
+)
 
 type IDeployer interface {
 	Deploy(context.Context, DeployParams) error
+	// Revision returns the commit SHA the running container was deployed from
+	Revision(ctx context.Context, containerName string) (string, error)
+	// Remove stops and removes the deployed container, its backup and its
+	// image
+	Remove(ctx context.Context, containerName string) error
+	// Deployed returns the revisions of the containers carrying the label,
+	// keyed by container name; backups kept during a deploy are left out
+	Deployed(ctx context.Context, label string) (map[string]string, error)
 }
 
 type DeployInvoker struct {
-	deployer IDeployer
-	git      git.IGitClient
-	cloneDir string
+	project   string
+	deployer  IDeployer
+	git       git.IGitClient
+	ref       git.TrackedRef
+	state     *state.State
+	clone     git.CloneParams
+	signature *git.SignaturePolicy
+	grace     time.Duration
+	bus       *events.Bus
+	reporter  *reporter
 }
 
 type DeployParams struct {
 	ContainerName string
+	BuildDir      string
+	Revision      string
+	// Labels are set on the container in addition to the revision
+	Labels map[string]string
+	// HostPort, when set, publishes ContainerPort on the host
+	HostPort      int
+	ContainerPort int
+	// Fresh pulls the base images and builds without the cache
+	Fresh bool
+}
+
+// DeployOptions adjust a single deploy.
+type DeployOptions struct {
+	// Revision pins the commit deployed instead of the head of the tracked ref
+	Revision string
+	// Fresh pulls the base images and builds without the cache
+	Fresh bool
 }
 
 type DIParams struct {
+	// Project names the project in the events published, and its container
+	// and image
+	Project  string
 	Deployer IDeployer
 	Git      git.IGitClient
-	CloneDir string
+	Ref      git.TrackedRef
+	State    *state.State
+	// Clone holds the clone dir and options; the URL, access token and ref
+	// are filled in on every deploy
+	Clone git.CloneParams
+	// Signature, when set, refuses to deploy commits not signed by its keys
+	Signature *git.SignaturePolicy
+	// Status, when set, reports deploys as commit statuses
+	Status *StatusParams
+	// Deployments, when set, records deploys with the provider's deployments API
+	Deployments *DeploymentsParams
+	// GracePeriod is how long a deploy in progress may carry on after the
+	// context is cancelled
+	GracePeriod time.Duration
+	// Bus receives the deploy events; the reporter subscribes to it
+	Bus *events.Bus
 }
 
 func NewDeployInvoker(params DIParams) *DeployInvoker {
-	return &DeployInvoker{
-		deployer: params.Deployer,
-		git:      params.Git,
-		cloneDir: params.CloneDir,
+	bus := params.Bus
+	if bus == nil {
+		bus = events.NewBus()
+	}
+
+	di := &DeployInvoker{
+		project:   params.Project,
+		deployer:  params.Deployer,
+		git:       params.Git,
+		ref:       params.Ref,
+		state:     params.State,
+		clone:     params.Clone,
+		signature: params.Signature,
+		grace:     params.GracePeriod,
+		bus:       bus,
+		reporter: &reporter{
+			git:         params.Git,
+			state:       params.State,
+			status:      params.Status,
+			deployments: params.Deployments,
+		},
 	}
+	bus.Subscribe(di.reporter.handle,
+		events.DeployStarted, events.DeploySucceeded, events.DeployFailed)
+	return di
 }
 
-func (di *DeployInvoker) Deploy(ctx context.Context) error {
+func (di *DeployInvoker) Deploy(ctx context.Context, opts DeployOptions) error {
 	slog.Debug("deploy triggered")
-	isEmpty, err := common.IsDirEmpty(di.cloneDir)
+	// no deploy is started once shutting down
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	shutdown := ctx
+	ctx, cancel := common.WithGrace(shutdown, di.grace)
+	defer cancel()
+
+	ref, err := git.ResolveRef(ctx, di.git, di.ref)
 	if err != nil {
 		return err
 	}
-	if !isEmpty {
-		if err := common.CleanDir(di.cloneDir); err != nil {
+
+	clone := di.clone
+	clone.URL = di.git.GetRawRepoURL()
+	clone.Ref = ref
+	clone.Revision = opts.Revision
+	if clone.AccessToken, err = di.git.GetAccessToken(ctx); err != nil {
+		return err
+	}
+	if clone.SSHKey != nil {
+		if clone.URL, err = git.SSHRepoURL(clone.URL); err != nil {
 			return err
 		}
-		slog.Debug("directory emptied", "clone_dir", di.cloneDir)
 	}
+	if err := di.git.Sync(ctx, clone); err != nil {
+		return err
+	}
+
+	commit, err := git.HeadCommit(clone.Dir)
+	if err != nil {
+		return err
+	}
+	revision := commit.SHA
 
-	accessToken := di.git.GetAccessToken()
-	repo := di.git.GetRawRepoURL()
-	if err := di.git.Clone(ctx, di.cloneDir, accessToken, repo); err != nil {
+	event := events.Event{
+		Project: di.project,
+		Ref:     ref.String(),
+		SHA:     revision,
+		Author:  commit.Author,
+		Fresh:   opts.Fresh,
+	}
+	started := time.Now()
+	di.state.StartDeploy(revision)
+	di.publish(ctx, events.DeployStarted, event)
+	err = di.deploy(ctx, clone.Dir, revision, opts.Fresh)
+	if err != nil && shutdown.Err() != nil {
+		// left in progress, so that the next start retries it
+		slog.Warn("deploy interrupted by shutdown", "revision", revision, "error", err)
 		return err
 	}
 
+	event.Duration = time.Since(started)
+	event.Err = err
+	di.state.FinishDeploy(revision, err)
+	// the commit itself failed, so it is only retried once it changes;
+	// failures before this point leave it to the next poll
+	di.state.SetLastSeen(revision)
+	if err != nil {
+		di.publish(ctx, events.DeployFailed, event)
+		if errors.Is(err, ErrRolledBack) {
+			di.publish(ctx, events.RolledBack, event)
+		}
+		return err
+	}
+	di.publish(ctx, events.DeploySucceeded, event)
+	slog.Info("deployed", "revision", revision)
+	return nil
+}
+
+// publish sends the event; subscribers failing to handle it never fail the
+// deploy.
+func (di *DeployInvoker) publish(ctx context.Context, typ events.Type, event events.Event) {
+	event.Type = typ
+	event.At = time.Time{}
+	if err := di.bus.Publish(ctx, event); err != nil {
+		slog.Warn("failed to publish event", "project", di.project, "error", err)
+	}
+}
+
+func (di *DeployInvoker) deploy(ctx context.Context, dir, revision string, fresh bool) error {
+	if di.signature != nil {
+		if err := git.VerifyHeadSignature(dir, *di.signature); err != nil {
+			slog.Error("refusing to deploy commit", "revision", revision, "error", err)
+			return err
+		}
+	}
+
 	return di.deployer.Deploy(ctx, DeployParams{
-		ContainerName: di.git.GetRepoName(),
+		ContainerName: di.project,
+		BuildDir:      dir,
+		Revision:      revision,
+		Fresh:         fresh,
 	})
 }
+
+// Teardown removes the deployed project and stops its environment.
+func (di *DeployInvoker) Teardown(ctx context.Context) error {
+	if err := di.deployer.Remove(ctx, di.project); err != nil {
+		return err
+	}
+	di.state.SetDeployed("")
+	slog.Info("container removed", "container_name", di.project)
+
+	return di.reporter.stopped(ctx)
+}
+
+// Restore reconciles the state with the running container, so that a
+// restart neither redeploys what is already live nor misses a deploy that
+// was cut short.
+func (di *DeployInvoker) Restore(ctx context.Context) error {
+	revision, err := di.deployer.Revision(ctx, di.project)
+	if err != nil {
+		return err
+	}
+
+	if deploying := di.state.Deploying(); deploying != "" {
+		slog.Warn("previous deploy was interrupted; it will be retried",
+			"revision", deploying, "running", revision)
+		di.state.FinishDeploy(deploying, errInterrupted)
+		di.publish(ctx, events.DeployFailed, events.Event{
+			Project: di.project,
+			SHA:     deploying,
+			Err:     errInterrupted,
+		})
+	}
+	if queued := di.state.Queued(); queued != "" {
+		slog.Info("deploy queued before the restart will be retried", "revision", queued)
+		di.state.SetQueued("")
+	}
+
+	if deployed := di.state.Deployed(); deployed != revision {
+		slog.Info("running container differs from the saved state",
+			"saved", deployed, "running", revision)
+	}
+	di.state.SetDeployed(revision)
+	slog.Debug("deployed revision restored", "revision", revision)
+	return nil
+}
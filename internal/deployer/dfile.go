@@ -17,13 +17,35 @@
 package deployer
 
 import (
+	"archive/tar"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
 	"slices"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/docker/docker/api/types/build"
 	"github.com/docker/docker/api/types/container"
-	"github.com/moby/moby/client"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/docker/go-connections/nat"
+)
+
+const (
+	dockerfileName = "Dockerfile"
+	// backupSuffix is appended to the name of the container being replaced
+	backupSuffix    = "-forge-previous"
+	rollbackTimeout = time.Minute
 )
 
 type DockerfileDeployer struct {
@@ -48,21 +70,126 @@ func NewDockerfileDeployer(cli *client.Client) IDeployer {
 //     (off by default).
 
 func (df *DockerfileDeployer) Deploy(ctx context.Context, params DeployParams) error {
+	if _, err := os.Stat(filepath.Join(params.BuildDir, dockerfileName)); errors.Is(err, os.ErrNotExist) {
+		return ErrDockerfileNotExist
+	} else if err != nil {
+		return err
+	}
+
+	backupName := params.ContainerName + backupSuffix
+	if err := df.reinstate(ctx, params.ContainerName, backupName); err != nil {
+		return fmt.Errorf("failed to reinstate previous container: %w", err)
+	}
+
+	image, err := df.build(ctx, params)
+	if err != nil {
+		return fmt.Errorf("failed to build image: %w", err)
+	}
+
 	var containers []container.Summary
-	containers, err := df.cli.ContainerList(ctx, container.ListOptions{})
+	containers, err = df.cli.ContainerList(ctx, container.ListOptions{All: true})
 	if err != nil {
 		return err
 	}
 
-	if err := df.safeRemoveContainer(ctx, containers, params.ContainerName); err != nil {
+	// with the deployed container in place, a backup left behind by an
+	// earlier run is of no use now
+	if err := df.safeRemoveContainer(ctx, containers, backupName); err != nil {
+		return err
+	}
+
+	previous, err := df.retire(ctx, containers, params.ContainerName, backupName)
+	if err != nil {
 		return err
 	}
 
-	res, err := df.cli.ContainerCreate(ctx, nil, nil, nil, nil, params.ContainerName)
+	id, err := df.start(ctx, image, params)
 	if err != nil {
+		if df.rollback(ctx, id, previous, params.ContainerName) {
+			return fmt.Errorf("%w: %w", ErrRolledBack, err)
+		}
 		return err
 	}
 
+	if previous != nil {
+		if err := df.cli.ContainerRemove(ctx, previous.id, container.RemoveOptions{
+			RemoveVolumes: true,
+			RemoveLinks:   true,
+		}); err != nil {
+			slog.Warn("failed to remove previous container",
+				"container_name", backupName, "error", err)
+		}
+	}
+	slog.Info("container started",
+		"container_name", params.ContainerName, "image", image, "revision", params.Revision,
+		slog.Int("host_port", params.HostPort))
+	return nil
+}
+
+// reinstate brings the backup back under the container name when no container
+// has that name. This happens when forge stopped between retiring the deployed
+// container and starting its replacement, leaving the backup as the only
+// working container.
+func (df *DockerfileDeployer) reinstate(ctx context.Context, containerName, backupName string) error {
+	containers, err := df.cli.ContainerList(ctx, container.ListOptions{All: true})
+	if err != nil {
+		return err
+	}
+
+	var backup *container.Summary
+	for i, c := range containers {
+		// docker reports names with a leading slash
+		if slices.Contains(c.Names, "/"+containerName) {
+			return nil
+		}
+		if slices.Contains(c.Names, "/"+backupName) {
+			backup = &containers[i]
+		}
+	}
+	if backup == nil {
+		return nil
+	}
+
+	if err := df.cli.ContainerRename(ctx, backup.ID, containerName); err != nil {
+		return err
+	}
+	if !isStoppable(backup.State) {
+		if err := df.cli.ContainerStart(ctx, backup.ID, container.StartOptions{}); err != nil {
+			return err
+		}
+	}
+	slog.Warn("reinstated the container left behind by an interrupted deploy",
+		"container_name", containerName)
+	return nil
+}
+
+// start creates and starts the container. The ID is returned once the
+// container exists, even if starting it failed.
+func (df *DockerfileDeployer) start(ctx context.Context, image string, params DeployParams) (string, error) {
+	labels := make(map[string]string)
+	maps.Copy(labels, params.Labels)
+	maps.Copy(labels, revisionLabels(params.Revision))
+
+	config := &container.Config{
+		Image:  image,
+		Labels: labels,
+	}
+	var hostConfig *container.HostConfig
+	if params.HostPort != 0 {
+		port := nat.Port(fmt.Sprintf("%d/tcp", params.ContainerPort))
+		config.ExposedPorts = nat.PortSet{port: struct{}{}}
+		hostConfig = &container.HostConfig{
+			PortBindings: nat.PortMap{
+				port: []nat.PortBinding{{HostPort: strconv.Itoa(params.HostPort)}},
+			},
+		}
+	}
+
+	res, err := df.cli.ContainerCreate(ctx, config, hostConfig, nil, nil, params.ContainerName)
+	if err != nil {
+		return "", err
+	}
+
 	if len(res.Warnings) > 0 {
 		warnMsg := fmt.Sprintf("warning occured during %s container deployment",
 			params.ContainerName)
@@ -72,9 +199,226 @@ func (df *DockerfileDeployer) Deploy(ctx context.Context, params DeployParams) e
 		}
 	}
 
+	return res.ID, df.cli.ContainerStart(ctx, res.ID, container.StartOptions{})
+}
+
+// retiredContainer is the container a deploy replaces, kept until the new
+// one has started
+type retiredContainer struct {
+	id      string
+	running bool
+}
+
+// retire stops the deployed container and moves it out of the way under
+// the backup name, so that it can be brought back if the deploy fails.
+func (df *DockerfileDeployer) retire(
+	ctx context.Context,
+	containers []container.Summary,
+	containerName, backupName string,
+) (*retiredContainer, error) {
+	for _, c := range containers {
+		// docker reports names with a leading slash
+		if !slices.Contains(c.Names, "/"+containerName) {
+			continue
+		}
+
+		retired := &retiredContainer{id: c.ID, running: isStoppable(c.State)}
+		if retired.running {
+			if err := df.cli.ContainerStop(ctx, c.ID, container.StopOptions{}); err != nil {
+				return nil, err
+			}
+		}
+		if err := df.cli.ContainerRename(ctx, c.ID, backupName); err != nil {
+			if retired.running {
+				if err := df.cli.ContainerStart(ctx, c.ID, container.StartOptions{}); err != nil {
+					slog.Error("failed to restart container", "container_name", containerName, "error", err)
+				}
+			}
+			return nil, err
+		}
+		return retired, nil
+	}
+	return nil, nil
+}
+
+// rollback removes the failed container and restores the previous one,
+// reporting whether it was restored. It runs to completion even when the
+// deploy was cancelled.
+func (df *DockerfileDeployer) rollback(ctx context.Context, failedID string, previous *retiredContainer, containerName string) bool {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rollbackTimeout)
+	defer cancel()
+
+	if failedID != "" {
+		if err := df.cli.ContainerRemove(ctx, failedID, container.RemoveOptions{Force: true}); err != nil {
+			slog.Error("failed to remove failed container", "container_name", containerName, "error", err)
+		}
+	}
+	if previous == nil {
+		return false
+	}
+
+	if err := df.cli.ContainerRename(ctx, previous.id, containerName); err != nil {
+		slog.Error("failed to roll back", "container_name", containerName, "error", err)
+		return false
+	}
+	if previous.running {
+		if err := df.cli.ContainerStart(ctx, previous.id, container.StartOptions{}); err != nil {
+			slog.Error("failed to roll back", "container_name", containerName, "error", err)
+			return false
+		}
+	}
+	slog.Warn("rolled back to the previous container", "container_name", containerName)
+	return true
+}
+
+func (df *DockerfileDeployer) Revision(ctx context.Context, containerName string) (string, error) {
+	c, err := df.cli.ContainerInspect(ctx, containerName)
+	if client.IsErrNotFound(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	return c.Config.Labels[RevisionLabel], nil
+}
+
+func (df *DockerfileDeployer) Remove(ctx context.Context, containerName string) error {
+	containers, err := df.cli.ContainerList(ctx, container.ListOptions{All: true})
+	if err != nil {
+		return err
+	}
+	for _, name := range []string{containerName, containerName + backupSuffix} {
+		if err := df.safeRemoveContainer(ctx, containers, name); err != nil {
+			return err
+		}
+	}
+
+	_, err = df.cli.ImageRemove(ctx, imageName(containerName), image.RemoveOptions{PruneChildren: true})
+	if err != nil && !client.IsErrNotFound(err) {
+		return fmt.Errorf("failed to remove image: %w", err)
+	}
 	return nil
 }
 
+func (df *DockerfileDeployer) Deployed(ctx context.Context, label string) (map[string]string, error) {
+	containers, err := df.cli.ContainerList(ctx, container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", label)),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	deployed := make(map[string]string, len(containers))
+	for _, c := range containers {
+		if len(c.Names) == 0 {
+			continue
+		}
+		// backups carry the labels of the container they stand in for
+		name := strings.TrimPrefix(c.Names[0], "/")
+		if strings.HasSuffix(name, backupSuffix) {
+			continue
+		}
+		deployed[name] = c.Labels[RevisionLabel]
+	}
+	return deployed, nil
+}
+
+// build builds the image from the clone dir and returns its reference
+func (df *DockerfileDeployer) build(ctx context.Context, params DeployParams) (string, error) {
+	image := imageName(params.ContainerName)
+	buildCtx := tarDir(params.BuildDir)
+	defer buildCtx.Close()
+
+	slog.Info("building image", "image", image, "build_dir", params.BuildDir, "fresh", params.Fresh)
+	res, err := df.cli.ImageBuild(ctx, buildCtx, build.ImageBuildOptions{
+		Tags:       []string{image},
+		Dockerfile: dockerfileName,
+		Labels:     revisionLabels(params.Revision),
+		Remove:     true,
+		PullParent: params.Fresh,
+		NoCache:    params.Fresh,
+	})
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if err := jsonmessage.DisplayJSONMessagesStream(res.Body, os.Stdout, 0, false, nil); err != nil {
+		return "", err
+	}
+	return image, nil
+}
+
+// imageName returns the tag of the image built for the container
+func imageName(containerName string) string {
+	return fmt.Sprintf("%s:latest", strings.ToLower(containerName))
+}
+
+// tarDir streams the directory as a tar archive, leaving out the .git dir
+func tarDir(dir string) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		tw := tar.NewWriter(pw)
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			rel, err := filepath.Rel(dir, path)
+			if err != nil || rel == "." {
+				return err
+			}
+			if d.IsDir() && d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+
+			var link string
+			if info.Mode()&fs.ModeSymlink != 0 {
+				if link, err = os.Readlink(path); err != nil {
+					return err
+				}
+			}
+
+			hdr, err := tar.FileInfoHeader(info, link)
+			if err != nil {
+				return err
+			}
+			hdr.Name = filepath.ToSlash(rel)
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			_, err = io.Copy(tw, f)
+			return err
+		})
+		if err == nil {
+			err = tw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
+
+func revisionLabels(revision string) map[string]string {
+	if revision == "" {
+		return nil
+	}
+	return map[string]string{RevisionLabel: revision}
+}
+
 // Removes container if exists
 func (df *DockerfileDeployer) safeRemoveContainer(
 	ctx context.Context,
@@ -82,7 +426,8 @@ func (df *DockerfileDeployer) safeRemoveContainer(
 	containerName string,
 ) error {
 	for _, c := range containers {
-		if slices.Contains(c.Names, containerName) {
+		// docker reports names with a leading slash
+		if slices.Contains(c.Names, "/"+containerName) {
 			if isStoppable(c.State) {
 				copts := container.StopOptions{}
 				err := df.cli.ContainerStop(ctx, c.ID, copts)
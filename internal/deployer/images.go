@@ -0,0 +1,215 @@
+// Forge - Automated Docker container deployment tool for VPS environments.
+// Monitors Git repositories and redeploys containers on new commits.
+// Copyright (C) 2025 Artemii Fedotov
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+package deployer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"smithery/forge/internal/clients/registry"
+	"smithery/forge/internal/events"
+	"smithery/forge/internal/state"
+	"sync"
+	"time"
+)
+
+// ImageWatcher resolves the tags of the deployed Dockerfile's base images
+// and asks for a rebuild when one of them points to a new digest, so that
+// patched base images reach the running container.
+type ImageWatcher struct {
+	project  string
+	dir      string
+	registry registry.IRegistryClient
+	state    *state.State
+	bus      *events.Bus
+	interval time.Duration
+
+	// mu guards updates and the base images in the state
+	mu sync.Mutex
+	// updates are the new digests not yet deployed, by image
+	updates map[string]imageUpdate
+}
+
+// imageUpdate is a new digest and when it was first seen
+type imageUpdate struct {
+	digest string
+	seen   time.Time
+}
+
+type ImageWatcherParams struct {
+	Project string
+	// Dir is the clone dir holding the deployed Dockerfile
+	Dir      string
+	Registry registry.IRegistryClient
+	State    *state.State
+	// Bus receives a RebuildScheduled event when a digest changes; fresh
+	// deploys succeeding on it record the new digests
+	Bus      *events.Bus
+	Interval time.Duration
+}
+
+func NewImageWatcher(params ImageWatcherParams) *ImageWatcher {
+	w := &ImageWatcher{
+		project:  params.Project,
+		dir:      params.Dir,
+		registry: params.Registry,
+		state:    params.State,
+		bus:      params.Bus,
+		interval: params.Interval,
+		updates:  make(map[string]imageUpdate),
+	}
+	w.bus.Subscribe(w.handleDeploy, events.DeploySucceeded)
+	return w
+}
+
+// Run checks the base images at every interval until the context is
+// cancelled.
+func (w *ImageWatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := w.Check(ctx); err != nil && ctx.Err() == nil {
+			slog.Warn("failed to check base images", "project", w.project, "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check resolves the base images and publishes a rebuild if a digest
+// differs from the one deployed. Images seen for the first time only have
+// their digest recorded. A new digest is recorded once a fresh deploy
+// succeeds, so until then every check asks for the rebuild again.
+func (w *ImageWatcher) Check(ctx context.Context) error {
+	deployed := w.state.Deployed()
+	if deployed == "" {
+		return nil
+	}
+
+	f, err := os.Open(filepath.Join(w.dir, dockerfileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	images, err := registry.BaseImages(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("failed to parse dockerfile: %w", err)
+	}
+
+	var (
+		resolved = make(map[string]string, len(images))
+		errs     []error
+	)
+	for _, image := range images {
+		digest, err := w.registry.Digest(ctx, image)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		resolved[image.String()] = digest
+	}
+
+	w.mu.Lock()
+	var (
+		now     = time.Now()
+		known   = w.state.BaseImages()
+		digests = make(map[string]string, len(images))
+		changed []string
+	)
+	for _, image := range images {
+		name := image.String()
+		previous, isKnown := known[name]
+		// images that failed to resolve keep their digest, so that a
+		// change is still noticed once they resolve again
+		if isKnown {
+			digests[name] = previous
+		}
+
+		digest, ok := resolved[name]
+		switch {
+		case !ok:
+		case !isKnown:
+			digests[name] = digest
+		case digest == previous:
+			delete(w.updates, name)
+		default:
+			if update, pending := w.updates[name]; !pending || update.digest != digest {
+				slog.Info("base image updated",
+					"project", w.project, "image", name, "previous", previous, "digest", digest)
+				w.updates[name] = imageUpdate{digest: digest, seen: now}
+			}
+			changed = append(changed, name)
+		}
+	}
+	for name := range w.updates {
+		if _, ok := digests[name]; !ok {
+			delete(w.updates, name)
+		}
+	}
+	w.state.SetBaseImages(digests)
+	w.mu.Unlock()
+
+	if len(changed) > 0 {
+		err := w.bus.Publish(ctx, events.Event{
+			Type:    events.RebuildScheduled,
+			Project: w.project,
+			SHA:     deployed,
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to schedule rebuild: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// handleDeploy records the new digests a fresh deploy picked up: those seen
+// before it started, since it pulled the base images after.
+func (w *ImageWatcher) handleDeploy(ctx context.Context, event events.Event) error {
+	if !event.Fresh {
+		return nil
+	}
+	started := event.At.Add(-event.Duration)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	digests := w.state.BaseImages()
+	var deployed bool
+	for name, update := range w.updates {
+		if update.seen.After(started) {
+			continue
+		}
+		slog.Info("updated base image deployed",
+			"project", w.project, "image", name, "digest", update.digest)
+		digests[name] = update.digest
+		delete(w.updates, name)
+		deployed = true
+	}
+	if deployed {
+		w.state.SetBaseImages(digests)
+	}
+	return nil
+}
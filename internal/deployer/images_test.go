@@ -0,0 +1,139 @@
+// Forge - Automated Docker container deployment tool for VPS environments.
+// Monitors Git repositories and redeploys containers on new commits.
+// Copyright (C) 2025 Artemii Fedotov
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+package deployer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"smithery/forge/internal/clients/registry"
+	"smithery/forge/internal/events"
+	"smithery/forge/internal/state"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRegistry resolves every image to the same digest
+type fakeRegistry struct {
+	mu     sync.Mutex
+	digest string
+}
+
+func (r *fakeRegistry) Digest(ctx context.Context, image registry.Image) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.digest, nil
+}
+
+func (r *fakeRegistry) set(digest string) {
+	r.mu.Lock()
+	r.digest = digest
+	r.mu.Unlock()
+}
+
+func TestImageWatcher(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, dockerfileName), []byte("FROM alpine:3.20\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	const image = "docker.io/library/alpine:3.20"
+
+	st := state.New()
+	st.SetDeployed("a")
+	bus := events.NewBus()
+	var (
+		mu       sync.Mutex
+		rebuilds int
+	)
+	bus.Subscribe(func(ctx context.Context, event events.Event) error {
+		mu.Lock()
+		rebuilds++
+		mu.Unlock()
+		return nil
+	}, events.RebuildScheduled)
+
+	reg := &fakeRegistry{digest: "sha256:old"}
+	w := NewImageWatcher(ImageWatcherParams{Project: "api", Dir: dir, Registry: reg, State: st, Bus: bus})
+	ctx := context.Background()
+
+	check := func(wantRebuilds int, wantDigest string) {
+		t.Helper()
+		if err := w.Check(ctx); err != nil {
+			t.Fatalf("Check() error = %v", err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if rebuilds != wantRebuilds {
+			t.Errorf("rebuilds = %d, want %d", rebuilds, wantRebuilds)
+		}
+		if got := st.BaseImages()[image]; got != wantDigest {
+			t.Errorf("recorded digest = %q, want %q", got, wantDigest)
+		}
+	}
+	deployed := func(typ events.Type, fresh bool, duration time.Duration) {
+		t.Helper()
+		err := bus.Publish(ctx, events.Event{Type: typ, Project: "api", SHA: "a", Fresh: fresh, Duration: duration})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// first seen digests are recorded without a rebuild
+	check(0, "sha256:old")
+
+	reg.set("sha256:new")
+	check(1, "sha256:old")
+
+	// the rebuild was skipped or failed: the change is noticed again
+	deployed(events.DeployFailed, true, time.Second)
+	check(2, "sha256:old")
+
+	// a deploy from cached layers does not pick the new image up
+	deployed(events.DeploySucceeded, false, time.Second)
+	check(3, "sha256:old")
+
+	// nor does a fresh deploy started before the change was seen
+	deployed(events.DeploySucceeded, true, time.Hour)
+	check(4, "sha256:old")
+
+	deployed(events.DeploySucceeded, true, 0)
+	check(4, "sha256:new")
+}
+
+func TestImageWatcherRevertedDigest(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, dockerfileName), []byte("FROM alpine:3.20\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	st := state.New()
+	st.SetDeployed("a")
+	reg := &fakeRegistry{digest: "sha256:old"}
+	w := NewImageWatcher(ImageWatcherParams{Project: "api", Dir: dir, Registry: reg, State: st, Bus: events.NewBus()})
+	ctx := context.Background()
+
+	for _, digest := range []string{"sha256:old", "sha256:new", "sha256:old"} {
+		reg.set(digest)
+		if err := w.Check(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(w.updates) != 0 {
+		t.Errorf("updates = %v, want none once the tag points back to the deployed digest", w.updates)
+	}
+}
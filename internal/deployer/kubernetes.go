@@ -27,3 +27,15 @@ func NewKubernetesDeployer() IDeployer {
 func (ku *KubernetesDeployer) Deploy(ctx context.Context, params DeployParams) error {
 	return nil
 }
+
+func (ku *KubernetesDeployer) Revision(ctx context.Context, containerName string) (string, error) {
+	return "", nil
+}
+
+func (ku *KubernetesDeployer) Remove(ctx context.Context, containerName string) error {
+	return nil
+}
+
+func (ku *KubernetesDeployer) Deployed(ctx context.Context, label string) (map[string]string, error) {
+	return nil, nil
+}
@@ -0,0 +1,309 @@
+// Forge - Automated Docker container deployment tool for VPS environments.
+// Monitors Git repositories and redeploys containers on new commits.
+// Copyright (C) 2025 Artemii Fedotov
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+package deployer
+
+import (
+	"context"
+	"log/slog"
+	"smithery/forge/internal/events"
+	"smithery/forge/internal/window"
+	"sync"
+	"time"
+)
+
+// Queue serializes the deploys of a project, so that no two of them share
+// the clone dir and container at once. Changes arriving while a deploy runs
+// are coalesced into one: a deploy always checks out the head of the
+// tracked ref, so deploying the newest change catches up with all of them.
+// A scheduled rebuild is folded into a queued change, which is then built
+// from fresh base images. With a settle delay, a change is only deployed
+// once no newer one arrived for that long, and with a schedule, changes are
+// held until deploys are allowed.
+type Queue struct {
+	di       *DeployInvoker
+	schedule *window.Schedule
+	settle   time.Duration
+	maxWait  time.Duration
+	wake     chan struct{}
+
+	mu           sync.Mutex
+	running      *events.Event
+	runningSince time.Time
+	pending      *events.Event
+	fresh        bool
+	coalesced    int
+	firstQueued  time.Time
+	lastQueued   time.Time
+	heldUntil    time.Time
+	heldReason   string
+}
+
+type QueueParams struct {
+	Invoker *DeployInvoker
+	// Schedule, when set, restricts when deploys may start
+	Schedule *window.Schedule
+	// Settle is how long no newer change has to arrive before one is
+	// deployed; MaxWait caps how long a burst of changes can delay it
+	Settle  time.Duration
+	MaxWait time.Duration
+}
+
+// QueueStatus is a snapshot of the deploy queue.
+type QueueStatus struct {
+	// Running is the change being deployed
+	Running      *events.Event
+	RunningSince time.Time
+	// Pending is the change deployed next
+	Pending *events.Event
+	// Fresh tells whether the pending deploy rebuilds from fresh base images
+	Fresh bool
+	// Coalesced counts the changes the pending one replaced
+	Coalesced int
+	// SettlesAt is when the pending change is deployed unless a newer one
+	// arrives
+	SettlesAt time.Time
+	// Held tells whether the schedule holds the pending change back;
+	// HeldUntil is zero when the schedule never opens again
+	Held       bool
+	HeldUntil  time.Time
+	HeldReason string
+}
+
+func NewQueue(params QueueParams) *Queue {
+	return &Queue{
+		di:       params.Invoker,
+		schedule: params.Schedule,
+		settle:   params.Settle,
+		maxWait:  params.MaxWait,
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// HandleChange queues the change; it is subscribed to ChangeDetected and
+// RebuildScheduled.
+func (q *Queue) HandleChange(ctx context.Context, event events.Event) error {
+	q.Enqueue(event)
+	return nil
+}
+
+// Enqueue queues the change, replacing the one queued before.
+func (q *Queue) Enqueue(event events.Event) {
+	q.mu.Lock()
+	// the observer reports a commit on every poll until its deploy finished
+	if q.repeats(event) {
+		q.mu.Unlock()
+		return
+	}
+	if event.Type == events.RebuildScheduled {
+		// a change being deployed is built from cached layers, so the
+		// rebuild still follows it
+		q.fresh = true
+		if q.pending != nil && q.pending.Type != events.RebuildScheduled {
+			slog.Info("rebuild folded into the queued deploy",
+				"project", q.di.project, "sha", q.pending.SHA)
+			q.mu.Unlock()
+			q.notify()
+			return
+		}
+	}
+
+	now := time.Now()
+	if q.pending == nil {
+		q.firstQueued = now
+	}
+	q.lastQueued = now
+
+	if q.pending != nil {
+		q.coalesced++
+		slog.Info("coalescing queued deploy",
+			"project", q.di.project, "replaced", q.pending.SHA, "sha", event.SHA,
+			slog.Int("coalesced", q.coalesced))
+	} else if q.running != nil {
+		slog.Info("deploy queued behind the one in progress",
+			"project", q.di.project, "sha", event.SHA, "running", q.running.SHA)
+	}
+	q.pending = &event
+	q.di.state.SetQueued(event.SHA)
+	q.mu.Unlock()
+	q.notify()
+}
+
+// repeats reports whether the change is already queued or being deployed;
+// the caller holds the lock.
+func (q *Queue) repeats(event events.Event) bool {
+	if event.Type != events.ChangeDetected || event.SHA == "" {
+		return false
+	}
+	if q.pending != nil {
+		return q.pending.Type == events.ChangeDetected && q.pending.SHA == event.SHA
+	}
+	return q.running != nil && q.running.SHA == event.SHA
+}
+
+func (q *Queue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Status returns the state of the queue.
+func (q *Queue) Status() QueueStatus {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return QueueStatus{
+		Running:      q.running,
+		RunningSince: q.runningSince,
+		Pending:      q.pending,
+		Fresh:        q.fresh,
+		Coalesced:    q.coalesced,
+		SettlesAt:    q.settlesAt(),
+		Held:         q.heldReason != "",
+		HeldUntil:    q.heldUntil,
+		HeldReason:   q.heldReason,
+	}
+}
+
+// Run deploys the queued changes one at a time until the context is
+// cancelled. A change still queued then is left in the state, so that the
+// next start deploys it.
+func (q *Queue) Run(ctx context.Context) {
+	timer := time.NewTimer(0)
+	<-timer.C
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.wake:
+		case <-timer.C:
+		}
+
+		event, opts, next := q.take(time.Now())
+		if event == nil {
+			// held changes are looked at again once the schedule opens
+			if !next.IsZero() {
+				timer.Reset(time.Until(next))
+			}
+			continue
+		}
+		if err := q.di.Deploy(ctx, opts); err != nil && ctx.Err() == nil {
+			slog.Error("deploy failed", "project", q.di.project, "sha", event.SHA, "error", err)
+		}
+
+		q.mu.Lock()
+		q.running = nil
+		q.runningSince = time.Time{}
+		q.mu.Unlock()
+	}
+}
+
+// take moves the queued change to running and returns how to deploy it. A
+// change the schedule holds is left queued, and the time it may be deployed
+// at is returned instead.
+func (q *Queue) take(now time.Time) (*events.Event, DeployOptions, time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.pending == nil {
+		return nil, DeployOptions{}, time.Time{}
+	}
+
+	if settles := q.settlesAt(); now.Before(settles) {
+		slog.Debug("waiting for changes to settle",
+			"project", q.di.project, "sha", q.pending.SHA, "until", settles)
+		return nil, DeployOptions{}, settles
+	}
+
+	if until, reason, held := q.hold(*q.pending, now); held {
+		// logged once per hold, not on every wake up
+		if reason != q.heldReason || !until.Equal(q.heldUntil) {
+			slog.Info("deploy held", "project", q.di.project, "sha", q.pending.SHA,
+				"reason", reason, "until", until)
+		}
+		q.heldUntil, q.heldReason = until, reason
+		return nil, DeployOptions{}, until
+	}
+
+	opts := DeployOptions{Fresh: q.fresh}
+	// a rebuild redeploys what is deployed now, not the head of the ref nor
+	// what was deployed when it was scheduled
+	if q.pending.Type == events.RebuildScheduled {
+		opts.Revision = q.di.state.Deployed()
+		if opts.Revision == "" {
+			slog.Info("skipping rebuild: nothing is deployed", "project", q.di.project)
+			q.clear()
+			return nil, DeployOptions{}, time.Time{}
+		}
+	}
+
+	q.running, q.runningSince = q.pending, now
+	q.clear()
+	return q.running, opts, time.Time{}
+}
+
+// clear empties the queue; the caller holds the lock.
+func (q *Queue) clear() {
+	q.pending = nil
+	q.fresh = false
+	q.coalesced = 0
+	q.firstQueued, q.lastQueued = time.Time{}, time.Time{}
+	q.heldUntil, q.heldReason = time.Time{}, ""
+	q.di.state.SetQueued("")
+}
+
+// settlesAt returns when the pending change has settled; the caller holds
+// the lock. Scheduled rebuilds do not wait.
+func (q *Queue) settlesAt() time.Time {
+	if q.settle == 0 || q.pending == nil || q.pending.Type == events.RebuildScheduled {
+		return time.Time{}
+	}
+
+	settles := q.lastQueued.Add(q.settle)
+	if deadline := q.firstQueued.Add(q.maxWait); q.maxWait > 0 && deadline.Before(settles) {
+		settles = deadline
+	}
+	return settles
+}
+
+// hold reports whether the schedule keeps the change from being deployed
+// now, why, and until when.
+func (q *Queue) hold(event events.Event, now time.Time) (time.Time, string, bool) {
+	if q.schedule == nil {
+		return time.Time{}, "", false
+	}
+
+	ok, reason := q.schedule.Allows(now)
+	if ok {
+		return time.Time{}, "", false
+	}
+	if event.Override {
+		if q.schedule.AllowOverride {
+			slog.Warn("deploying outside the schedule by override",
+				"project", q.di.project, "sha", event.SHA, "reason", reason)
+			return time.Time{}, "", false
+		}
+		slog.Warn("ignoring deploy override: overrides are not allowed",
+			"project", q.di.project, "sha", event.SHA)
+	}
+
+	until := q.schedule.Next(now)
+	if until.IsZero() {
+		slog.Warn("deploy schedule never opens", "project", q.di.project, "sha", event.SHA)
+	}
+	return until, reason, true
+}
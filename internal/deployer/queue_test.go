@@ -0,0 +1,114 @@
+// Forge - Automated Docker container deployment tool for VPS environments.
+// Monitors Git repositories and redeploys containers on new commits.
+// Copyright (C) 2025 Artemii Fedotov
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+package deployer
+
+import (
+	"smithery/forge/internal/events"
+	"smithery/forge/internal/state"
+	"testing"
+	"time"
+)
+
+func TestSettlesAt(t *testing.T) {
+	t0 := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	change := &events.Event{Type: events.ChangeDetected, SHA: "b"}
+	rebuild := &events.Event{Type: events.RebuildScheduled, SHA: "a"}
+
+	tests := []struct {
+		name        string
+		settle      time.Duration
+		maxWait     time.Duration
+		pending     *events.Event
+		firstQueued time.Time
+		lastQueued  time.Time
+		want        time.Time
+	}{
+		{"nothing queued", 10 * time.Second, time.Minute, nil, time.Time{}, time.Time{}, time.Time{}},
+		{"no debounce", 0, 0, change, t0, t0, time.Time{}},
+		{"rebuilds do not wait", 10 * time.Second, time.Minute, rebuild, t0, t0, time.Time{}},
+		{"single change", 10 * time.Second, time.Minute, change, t0, t0, t0.Add(10 * time.Second)},
+		{"settle restarts on each change", 10 * time.Second, time.Minute, change, t0, t0.Add(30 * time.Second), t0.Add(40 * time.Second)},
+		{"max wait caps a burst", 10 * time.Second, time.Minute, change, t0, t0.Add(55 * time.Second), t0.Add(time.Minute)},
+		{"settle and max wait meet", 10 * time.Second, time.Minute, change, t0, t0.Add(50 * time.Second), t0.Add(time.Minute)},
+		{"no max wait", 10 * time.Second, 0, change, t0, t0.Add(time.Hour), t0.Add(time.Hour + 10*time.Second)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := &Queue{
+				settle:      tt.settle,
+				maxWait:     tt.maxWait,
+				pending:     tt.pending,
+				firstQueued: tt.firstQueued,
+				lastQueued:  tt.lastQueued,
+			}
+			if got := q.settlesAt(); !got.Equal(tt.want) {
+				t.Errorf("settlesAt() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTakeWaitsToSettle(t *testing.T) {
+	t0 := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	q := NewQueue(QueueParams{
+		Invoker: &DeployInvoker{project: "api", state: state.New()},
+		Settle:  10 * time.Second,
+		MaxWait: time.Minute,
+	})
+	q.pending = &events.Event{Type: events.ChangeDetected, SHA: "b"}
+	q.firstQueued, q.lastQueued = t0, t0.Add(5*time.Second)
+
+	event, _, next := q.take(t0.Add(10 * time.Second))
+	if event != nil {
+		t.Fatalf("take() = %s before the change settled", event.SHA)
+	}
+	if want := t0.Add(15 * time.Second); !next.Equal(want) {
+		t.Errorf("take() retries at %s, want %s", next, want)
+	}
+
+	event, _, _ = q.take(next)
+	if event == nil || event.SHA != "b" {
+		t.Fatalf("take() = %v once settled, want b", event)
+	}
+	if status := q.Status(); status.Pending != nil || status.Running == nil {
+		t.Errorf("Status() = %+v, want the change running and none pending", status)
+	}
+}
+
+func TestEnqueueIgnoresRepeats(t *testing.T) {
+	q := NewQueue(QueueParams{Invoker: &DeployInvoker{project: "api", state: state.New()}})
+	change := events.Event{Type: events.ChangeDetected, SHA: "b"}
+
+	q.Enqueue(change)
+	q.Enqueue(change)
+	if status := q.Status(); status.Coalesced != 0 {
+		t.Errorf("Status().Coalesced = %d after a repeat, want 0", status.Coalesced)
+	}
+
+	if event, _, _ := q.take(time.Now()); event == nil {
+		t.Fatal("take() = nil, want the change")
+	}
+	q.Enqueue(change)
+	if status := q.Status(); status.Pending != nil {
+		t.Errorf("Status().Pending = %v while the same commit is deployed, want nil", status.Pending)
+	}
+
+	q.Enqueue(events.Event{Type: events.ChangeDetected, SHA: "c"})
+	if status := q.Status(); status.Pending == nil || status.Pending.SHA != "c" {
+		t.Errorf("Status().Pending = %v, want c queued behind b", status.Pending)
+	}
+}
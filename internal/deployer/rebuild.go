@@ -0,0 +1,89 @@
+// Forge - Automated Docker container deployment tool for VPS environments.
+// Monitors Git repositories and redeploys containers on new commits.
+// Copyright (C) 2025 Artemii Fedotov
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+package deployer
+
+import (
+	"context"
+	"log/slog"
+	"smithery/forge/internal/cron"
+	"smithery/forge/internal/events"
+	"smithery/forge/internal/state"
+	"time"
+)
+
+// Rebuilder asks for the deployed commit to be rebuilt on a schedule, so
+// that updates to the base images reach the running container even without
+// new commits.
+type Rebuilder struct {
+	project  string
+	schedule *cron.Schedule
+	state    *state.State
+	bus      *events.Bus
+}
+
+type RebuilderParams struct {
+	Project  string
+	Schedule *cron.Schedule
+	State    *state.State
+	// Bus receives a RebuildScheduled event at every activation
+	Bus *events.Bus
+}
+
+func NewRebuilder(params RebuilderParams) *Rebuilder {
+	return &Rebuilder{
+		project:  params.Project,
+		schedule: params.Schedule,
+		state:    params.State,
+		bus:      params.Bus,
+	}
+}
+
+// Run publishes the scheduled rebuilds until the context is cancelled.
+func (r *Rebuilder) Run(ctx context.Context) {
+	for {
+		next := r.schedule.Next(time.Now())
+		if next.IsZero() {
+			slog.Warn("rebuild schedule never activates",
+				"project", r.project, "schedule", r.schedule.String())
+			return
+		}
+		slog.Debug("next rebuild scheduled", "project", r.project, "at", next)
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		deployed := r.state.Deployed()
+		if deployed == "" {
+			slog.Info("skipping scheduled rebuild: nothing is deployed", "project", r.project)
+			continue
+		}
+		slog.Info("scheduled rebuild", "project", r.project, "sha", deployed)
+		err := r.bus.Publish(ctx, events.Event{
+			Type:    events.RebuildScheduled,
+			Project: r.project,
+			SHA:     deployed,
+		})
+		if err != nil {
+			slog.Error("failed to schedule rebuild", "project", r.project, "error", err)
+		}
+	}
+}
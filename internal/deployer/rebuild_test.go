@@ -0,0 +1,81 @@
+// Forge - Automated Docker container deployment tool for VPS environments.
+// Monitors Git repositories and redeploys containers on new commits.
+// Copyright (C) 2025 Artemii Fedotov
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+package deployer
+
+import (
+	"smithery/forge/internal/events"
+	"smithery/forge/internal/state"
+	"testing"
+	"time"
+)
+
+func newTestQueue(st *state.State) *Queue {
+	return NewQueue(QueueParams{Invoker: &DeployInvoker{project: "api", state: st}})
+}
+
+func TestRebuildFollowsRunningChange(t *testing.T) {
+	st := state.New()
+	st.SetDeployed("a")
+	q := newTestQueue(st)
+	q.running = &events.Event{Type: events.ChangeDetected, SHA: "b"}
+
+	q.Enqueue(events.Event{Type: events.RebuildScheduled, SHA: "a"})
+	status := q.Status()
+	if status.Pending == nil || status.Pending.Type != events.RebuildScheduled || !status.Fresh {
+		t.Fatalf("Status() = %+v, want a fresh rebuild pending", status)
+	}
+
+	// the change finished deploying; the rebuild redeploys it
+	q.running = nil
+	st.SetDeployed("b")
+	event, opts, _ := q.take(time.Now())
+	if event == nil {
+		t.Fatal("take() = nil, want the rebuild")
+	}
+	if want := (DeployOptions{Revision: "b", Fresh: true}); opts != want {
+		t.Errorf("take() options = %+v, want %+v", opts, want)
+	}
+}
+
+func TestRebuildFoldsIntoQueuedChange(t *testing.T) {
+	st := state.New()
+	st.SetDeployed("a")
+	q := newTestQueue(st)
+
+	q.Enqueue(events.Event{Type: events.ChangeDetected, SHA: "b"})
+	q.Enqueue(events.Event{Type: events.RebuildScheduled, SHA: "a"})
+
+	event, opts, _ := q.take(time.Now())
+	if event == nil || event.SHA != "b" {
+		t.Fatalf("take() = %v, want the change to b", event)
+	}
+	if want := (DeployOptions{Fresh: true}); opts != want {
+		t.Errorf("take() options = %+v, want %+v", opts, want)
+	}
+}
+
+func TestRebuildWithNothingDeployed(t *testing.T) {
+	q := newTestQueue(state.New())
+
+	q.Enqueue(events.Event{Type: events.RebuildScheduled})
+	if event, _, _ := q.take(time.Now()); event != nil {
+		t.Errorf("take() = %v, want the rebuild dropped", event)
+	}
+	if status := q.Status(); status.Pending != nil || status.Fresh {
+		t.Errorf("Status() = %+v, want an empty queue", status)
+	}
+}
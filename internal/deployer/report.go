@@ -0,0 +1,166 @@
+// Forge - Automated Docker container deployment tool for VPS environments.
+// Monitors Git repositories and redeploys containers on new commits.
+// Copyright (C) 2025 Artemii Fedotov
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+package deployer
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"smithery/forge/internal/clients/git"
+	"smithery/forge/internal/events"
+	"smithery/forge/internal/state"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// StatusParams configures the commit statuses reported for deploys
+type StatusParams struct {
+	Context   string
+	TargetURL string
+}
+
+// DeploymentsParams configures the deployments recorded for deploys
+type DeploymentsParams struct {
+	Environment    string
+	EnvironmentURL string
+}
+
+// reporter publishes deploy progress to the git provider. Failing to do so
+// never fails the deploy itself. The deployment being rolled out and the
+// one running are kept in the state, so the live one is marked inactive
+// once a newer one succeeds, even across restarts.
+type reporter struct {
+	git         git.IGitClient
+	state       *state.State
+	status      *StatusParams
+	deployments *DeploymentsParams
+}
+
+// handle reports the deploy events.
+func (r *reporter) handle(ctx context.Context, event events.Event) error {
+	switch event.Type {
+	case events.DeployStarted:
+		r.started(ctx, plumbing.ReferenceName(event.Ref), event.SHA)
+	case events.DeploySucceeded, events.DeployFailed:
+		r.finished(ctx, event.SHA, event.Err)
+	}
+	return nil
+}
+
+func (r *reporter) started(ctx context.Context, ref plumbing.ReferenceName, revision string) {
+	r.setStatus(ctx, revision, git.StatusPending, "Deployment started")
+
+	if r.deployments == nil {
+		return
+	}
+
+	deployment, err := r.git.CreateDeployment(ctx, git.DeploymentParams{
+		Ref:            ref,
+		SHA:            revision,
+		Environment:    r.deployments.Environment,
+		EnvironmentURL: r.deployments.EnvironmentURL,
+		Description:    "Deployed by forge",
+	})
+	if err != nil {
+		slog.Warn("failed to create deployment", "revision", revision, "error", err)
+		return
+	}
+	r.state.SetPendingDeployment(toState(deployment))
+	r.setDeploymentStatus(ctx, deployment, git.DeploymentInProgress, "Deployment started")
+}
+
+func (r *reporter) finished(ctx context.Context, revision string, deployErr error) {
+	pending := fromState(r.state.PendingDeployment())
+	if deployErr != nil {
+		description := fmt.Sprintf("Deployment failed: %s", deployErr)
+		r.setStatus(ctx, revision, git.StatusFailure, description)
+		r.setDeploymentStatus(ctx, pending, git.DeploymentFailure, description)
+		r.state.SetPendingDeployment(nil)
+		return
+	}
+
+	r.setStatus(ctx, revision, git.StatusSuccess, "Deployed")
+	r.setDeploymentStatus(ctx, pending, git.DeploymentSuccess, "Deployed")
+	if pending == nil {
+		return
+	}
+
+	r.setDeploymentStatus(ctx, fromState(r.state.LiveDeployment()), git.DeploymentInactive, "Superseded")
+	r.state.SetLiveDeployment(toState(pending))
+	r.state.SetPendingDeployment(nil)
+}
+
+func (r *reporter) stopped(ctx context.Context) error {
+	if r.deployments == nil {
+		return nil
+	}
+
+	if err := r.git.StopEnvironment(ctx, r.deployments.Environment); err != nil {
+		return fmt.Errorf("failed to stop environment: %w", err)
+	}
+	r.state.SetLiveDeployment(nil)
+	slog.Info("environment stopped", "environment", r.deployments.Environment)
+	return nil
+}
+
+func (r *reporter) setStatus(ctx context.Context, revision string, state git.StatusState, description string) {
+	if r.status == nil {
+		return
+	}
+
+	err := r.git.SetCommitStatus(ctx, revision, git.CommitStatus{
+		State:       state,
+		Context:     r.status.Context,
+		Description: description,
+		TargetURL:   r.status.TargetURL,
+	})
+	if err != nil {
+		slog.Warn("failed to set commit status",
+			"revision", revision, "state", string(state), "error", err)
+	}
+}
+
+func (r *reporter) setDeploymentStatus(ctx context.Context, deployment *git.Deployment, state git.DeploymentState, description string) {
+	// a deployment saved by an earlier run is left alone once disabled
+	if deployment == nil || r.deployments == nil {
+		return
+	}
+
+	err := r.git.SetDeploymentStatus(ctx, deployment, git.DeploymentStatus{
+		State:          state,
+		Description:    description,
+		EnvironmentURL: r.deployments.EnvironmentURL,
+	})
+	if err != nil {
+		slog.Warn("failed to set deployment status",
+			"deployment_id", deployment.Id, "state", string(state), "error", err)
+	}
+}
+
+func toState(d *git.Deployment) *state.Deployment {
+	if d == nil {
+		return nil
+	}
+	return &state.Deployment{Id: d.Id, SHA: d.SHA, Environment: d.Environment}
+}
+
+func fromState(d *state.Deployment) *git.Deployment {
+	if d == nil {
+		return nil
+	}
+	return &git.Deployment{Id: d.Id, SHA: d.SHA, Environment: d.Environment}
+}
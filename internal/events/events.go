@@ -0,0 +1,136 @@
+// Forge - Automated Docker container deployment tool for VPS environments.
+// Monitors Git repositories and redeploys containers on new commits.
+// Copyright (C) 2025 Artemii Fedotov
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+type Type string
+
+const (
+	// ChangeDetected is published when the tracked ref moved to a commit
+	// that should be deployed
+	ChangeDetected Type = "change_detected"
+	DeployStarted  Type = "deploy_started"
+	// DeploySucceeded and DeployFailed end every DeployStarted
+	DeploySucceeded Type = "deploy_succeeded"
+	DeployFailed    Type = "deploy_failed"
+	// RolledBack follows a DeployFailed when the previous container was
+	// brought back
+	RolledBack Type = "rolled_back"
+	// RebuildScheduled asks for the deployed commit to be rebuilt from
+	// fresh base images
+	RebuildScheduled Type = "rebuild_scheduled"
+)
+
+type Event struct {
+	Type    Type
+	Project string
+	// Ref is the full name of the branch or tag, e.g. refs/heads/main
+	Ref    string
+	SHA    string
+	Author string
+	// At is when the event happened
+	At time.Time
+	// Duration is how long the deploy took, on the events ending it
+	Duration time.Duration
+	// Err is why the deploy failed
+	Err error
+	// Override asks for the change to be deployed outside deploy windows
+	// and freezes
+	Override bool
+	// Fresh tells whether the deploy pulled the base images and skipped the
+	// build cache
+	Fresh bool
+}
+
+// Handler handles an event. Handlers of the same event run concurrently.
+type Handler func(context.Context, Event) error
+
+type subscription struct {
+	types   []Type
+	handler Handler
+}
+
+// Bus delivers events to the handlers subscribed to them.
+type Bus struct {
+	mu            sync.RWMutex
+	subscriptions []subscription
+}
+
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Subscribe registers the handler for the given event types, or for every
+// event when none are given.
+func (b *Bus) Subscribe(handler Handler, types ...Type) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscriptions = append(b.subscriptions, subscription{types: types, handler: handler})
+}
+
+// Publish delivers the event to its handlers and waits for them. Their
+// errors are joined; a panicking handler is reported as an error as well.
+func (b *Bus) Publish(ctx context.Context, event Event) error {
+	if event.At.IsZero() {
+		event.At = time.Now()
+	}
+
+	// handlers may publish events themselves, so the lock is not held
+	// while they run
+	b.mu.RLock()
+	var handlers []Handler
+	for _, sub := range b.subscriptions {
+		if len(sub.types) == 0 || slices.Contains(sub.types, event.Type) {
+			handlers = append(handlers, sub.handler)
+		}
+	}
+	b.mu.RUnlock()
+
+	slog.Debug("publishing event",
+		"type", string(event.Type), "project", event.Project, "sha", event.SHA,
+		slog.Int("handlers", len(handlers)))
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(handlers))
+	for idx, handler := range handlers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				if r := recover(); r != nil {
+					errs[idx] = fmt.Errorf("event handler panicked: %v", r)
+				}
+			}()
+			errs[idx] = handler(ctx, event)
+		}()
+	}
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("failed to handle %s event: %w", event.Type, err)
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+// Forge - Automated Docker container deployment tool for VPS environments.
+// Monitors Git repositories and redeploys containers on new commits.
+// Copyright (C) 2025 Artemii Fedotov
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net"
+	"net/http"
+	"slices"
+	"smithery/forge/internal/events"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	readHeaderTimeout = 10 * time.Second
+	shutdownTimeout   = 5 * time.Second
+)
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// project holds the counters of one project
+type project struct {
+	changes       uint64
+	started       uint64
+	succeeded     uint64
+	failed        uint64
+	rolledBack    uint64
+	durationSum   time.Duration
+	durationCount uint64
+	lastSuccess   time.Time
+}
+
+// Metrics counts the deploy events of the projects and serves them in the
+// Prometheus text format.
+type Metrics struct {
+	addr string
+	path string
+
+	mu       sync.Mutex
+	projects map[string]*project
+}
+
+type MetricsParams struct {
+	Address string
+	Path    string
+}
+
+func New(params MetricsParams) *Metrics {
+	return &Metrics{
+		addr:     params.Address,
+		path:     params.Path,
+		projects: make(map[string]*project),
+	}
+}
+
+// Subscribe counts the events published on the bus.
+func (m *Metrics) Subscribe(bus *events.Bus) {
+	bus.Subscribe(m.handle,
+		events.ChangeDetected, events.DeployStarted, events.DeploySucceeded,
+		events.DeployFailed, events.RolledBack)
+}
+
+func (m *Metrics) handle(_ context.Context, event events.Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, ok := m.projects[event.Project]
+	if !ok {
+		p = &project{}
+		m.projects[event.Project] = p
+	}
+
+	switch event.Type {
+	case events.ChangeDetected:
+		p.changes++
+	case events.DeployStarted:
+		p.started++
+	case events.DeploySucceeded:
+		p.succeeded++
+		p.lastSuccess = event.At
+		p.observe(event.Duration)
+	case events.DeployFailed:
+		p.failed++
+		p.observe(event.Duration)
+	case events.RolledBack:
+		p.rolledBack++
+	}
+	return nil
+}
+
+func (p *project) observe(d time.Duration) {
+	// a deploy interrupted by a restart ends without a duration
+	if d > 0 {
+		p.durationSum += d
+		p.durationCount++
+	}
+}
+
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := m.write(w); err != nil {
+		slog.Debug("failed to write metrics", "error", err)
+	}
+}
+
+// metric is one metric family; value returns its samples for a project.
+type metric struct {
+	name  string
+	typ   string
+	help  string
+	value func(p *project) []sample
+}
+
+type sample struct {
+	suffix string
+	labels string
+	value  float64
+}
+
+var families = []metric{
+	{"forge_changes_detected_total", "counter", "Changes of the tracked ref to deploy.",
+		func(p *project) []sample { return []sample{{value: float64(p.changes)}} }},
+	{"forge_deploys_started_total", "counter", "Deploys started.",
+		func(p *project) []sample { return []sample{{value: float64(p.started)}} }},
+	{"forge_deploys_total", "counter", "Deploys finished, by result.",
+		func(p *project) []sample {
+			return []sample{
+				{labels: `,result="succeeded"`, value: float64(p.succeeded)},
+				{labels: `,result="failed"`, value: float64(p.failed)},
+			}
+		}},
+	{"forge_rollbacks_total", "counter", "Failed deploys undone by bringing the previous container back.",
+		func(p *project) []sample { return []sample{{value: float64(p.rolledBack)}} }},
+	{"forge_deploy_duration_seconds", "summary", "How long finished deploys took.",
+		func(p *project) []sample {
+			return []sample{
+				{suffix: "_sum", value: p.durationSum.Seconds()},
+				{suffix: "_count", value: float64(p.durationCount)},
+			}
+		}},
+	{"forge_last_deploy_success_timestamp_seconds", "gauge", "When the last deploy succeeded, 0 if none has.",
+		func(p *project) []sample {
+			var at float64
+			if !p.lastSuccess.IsZero() {
+				at = float64(p.lastSuccess.UnixMilli()) / 1000
+			}
+			return []sample{{value: at}}
+		}},
+}
+
+func (m *Metrics) write(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b strings.Builder
+	names := slices.Sorted(maps.Keys(m.projects))
+	for _, family := range families {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", family.name, family.help, family.name, family.typ)
+		for _, name := range names {
+			for _, s := range family.value(m.projects[name]) {
+				fmt.Fprintf(&b, "%s%s{project=\"%s\"%s} %g\n",
+					family.name, s.suffix, labelEscaper.Replace(name), s.labels, s.value)
+			}
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Run serves the metrics until the context is cancelled.
+func (m *Metrics) Run(ctx context.Context) error {
+	mux := http.NewServeMux()
+	mux.Handle("GET "+m.path, m)
+
+	srv := &http.Server{
+		Addr:              m.addr,
+		Handler:           mux,
+		ReadHeaderTimeout: readHeaderTimeout,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		slog.Info("metrics server started", "address", m.addr, "path", m.path)
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		return srv.Shutdown(shutdownCtx)
+	}
+}
@@ -0,0 +1,70 @@
+// Forge - Automated Docker container deployment tool for VPS environments.
+// Monitors Git repositories and redeploys containers on new commits.
+// Copyright (C) 2025 Artemii Fedotov
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"smithery/forge/internal/events"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	m := New(MetricsParams{Path: "/metrics"})
+	bus := events.NewBus()
+	m.Subscribe(bus)
+
+	at := time.Unix(1700000000, 0)
+	for _, event := range []events.Event{
+		{Type: events.ChangeDetected, Project: "api", SHA: "a"},
+		{Type: events.DeployStarted, Project: "api", SHA: "a"},
+		{Type: events.DeploySucceeded, Project: "api", SHA: "a", At: at, Duration: 2 * time.Second},
+		{Type: events.DeployStarted, Project: "api", SHA: "b"},
+		{Type: events.DeployFailed, Project: "api", SHA: "b", Duration: time.Second, Err: errors.New("boom")},
+		{Type: events.RolledBack, Project: "api", SHA: "b", Duration: time.Second, Err: errors.New("boom")},
+		{Type: events.DeployFailed, Project: "web", SHA: "c"},
+	} {
+		if err := bus.Publish(context.Background(), event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	for _, want := range []string{
+		`forge_changes_detected_total{project="api"} 1`,
+		`forge_deploys_started_total{project="api"} 2`,
+		`forge_deploys_total{project="api",result="succeeded"} 1`,
+		`forge_deploys_total{project="api",result="failed"} 1`,
+		`forge_deploys_total{project="web",result="failed"} 1`,
+		`forge_rollbacks_total{project="api"} 1`,
+		`forge_deploy_duration_seconds_sum{project="api"} 3`,
+		`forge_deploy_duration_seconds_count{project="api"} 2`,
+		`forge_deploy_duration_seconds_count{project="web"} 0`,
+		`forge_last_deploy_success_timestamp_seconds{project="api"} 1.7e+09`,
+		"# TYPE forge_deploys_total counter",
+	} {
+		if !strings.Contains(body, want+"\n") {
+			t.Errorf("metrics lack %q:\n%s", want, body)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+// Forge - Automated Docker container deployment tool for VPS environments.
+// Monitors Git repositories and redeploys containers on new commits.
+// Copyright (C) 2025 Artemii Fedotov
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"smithery/forge/internal/events"
+)
+
+// Subscribe makes the notifier report failed and rolled back deploys
+// published on the bus.
+func Subscribe(bus *events.Bus, n INotifier) {
+	bus.Subscribe(func(ctx context.Context, event events.Event) error {
+		return n.Notify(message(event))
+	}, events.DeployFailed, events.RolledBack)
+}
+
+func message(event events.Event) string {
+	sha := event.SHA
+	if len(sha) > 7 {
+		sha = sha[:7]
+	}
+
+	switch event.Type {
+	case events.RolledBack:
+		return fmt.Sprintf("%s: deploy of %s rolled back to the previous container", event.Project, sha)
+	default:
+		return fmt.Sprintf("%s: deploy of %s by %s failed: %v", event.Project, sha, event.Author, event.Err)
+	}
+}
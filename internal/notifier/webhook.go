@@ -0,0 +1,68 @@
+// Forge - Automated Docker container deployment tool for VPS environments.
+// Monitors Git repositories and redeploys containers on new commits.
+// Copyright (C) 2025 Artemii Fedotov
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+package notifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"smithery/forge/internal/clients/httpclient"
+	"smithery/forge/internal/common"
+)
+
+// Webhook posts notifications to an incoming webhook as `{"text": ...}`,
+// the payload Slack and Mattermost accept.
+type Webhook struct {
+	httpclient *httpclient.HttpClient
+	url        *url.URL
+}
+
+type WebhookParams struct {
+	HttpClient *httpclient.HttpClient
+	URL        *url.URL
+}
+
+type webhookMessage struct {
+	Text string `json:"text"`
+}
+
+func NewWebhook(params WebhookParams) *Webhook {
+	return &Webhook{
+		httpclient: params.HttpClient,
+		url:        params.URL,
+	}
+}
+
+func (w *Webhook) Notify(message string) error {
+	// the http client's timeout bounds the request
+	res, err := w.httpclient.Post(context.Background(), w.url, nil, webhookMessage{Text: message})
+	if err != nil {
+		// the URL carries the webhook's credentials, so it stays out of logs
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("failed to send notification to %s: %w", w.url.Host, err)
+	}
+
+	defer res.Body.Close()
+	if !common.IsOK(res) {
+		return fmt.Errorf("notification webhook response was %s", res.Status)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+// Forge - Automated Docker container deployment tool for VPS environments.
+// Monitors Git repositories and redeploys containers on new commits.
+// Copyright (C) 2025 Artemii Fedotov
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+package notifier
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"smithery/forge/internal/clients/httpclient"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestWebhook(t *testing.T, handler http.HandlerFunc) *Webhook {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	u, err := url.Parse(server.URL + "/hooks/secret-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewWebhook(WebhookParams{HttpClient: httpclient.New(time.Second), URL: u})
+}
+
+func TestWebhookNotify(t *testing.T) {
+	var got webhookMessage
+	w := newTestWebhook(t, func(rw http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("failed to decode payload: %v", err)
+		}
+	})
+
+	if err := w.Notify("api: deploy of abc1234 failed"); err != nil {
+		t.Fatalf("Notify() = %v", err)
+	}
+	if got.Text != "api: deploy of abc1234 failed" {
+		t.Errorf("payload text = %q", got.Text)
+	}
+}
+
+func TestWebhookNotifyFailure(t *testing.T) {
+	w := newTestWebhook(t, func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusForbidden)
+	})
+	if err := w.Notify("message"); err == nil {
+		t.Error("Notify() = nil, want the rejection")
+	}
+
+	w.url.Host = "127.0.0.1:1"
+	err := w.Notify("message")
+	if err == nil {
+		t.Fatal("Notify() = nil, want the connection error")
+	}
+	if strings.Contains(err.Error(), "secret-token") {
+		t.Errorf("Notify() = %v, leaks the webhook URL", err)
+	}
+}
@@ -0,0 +1,90 @@
+// Forge - Automated Docker container deployment tool for VPS environments.
+// Monitors Git repositories and redeploys containers on new commits.
+// Copyright (C) 2025 Artemii Fedotov
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+package observer
+
+import (
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"time"
+)
+
+const (
+	// maxBackoff caps the wait between polls after consecutive failures
+	maxBackoff = 15 * time.Minute
+	// escalateAfter is the number of consecutive failures after which they
+	// are reported as errors rather than warnings
+	escalateAfter = 5
+)
+
+// backoff tracks consecutive poll failures.
+type backoff struct {
+	failures int
+	since    time.Time
+}
+
+// fail records a failed poll and returns how long to wait before the next
+// one: the interval doubled for every consecutive failure, up to maxBackoff,
+// with up to half of it as random jitter so observers that failed together
+// do not retry together.
+func (o *Observer) fail(err error) time.Duration {
+	if o.backoff.failures == 0 {
+		o.backoff.since = time.Now()
+	}
+	o.backoff.failures++
+
+	delay := maxBackoff
+	if shift := o.backoff.failures - 1; shift < 32 && o.interval<<shift < maxBackoff {
+		delay = o.interval << shift
+	}
+	delay = max(delay, o.interval)
+	delay = delay/2 + rand.N(delay/2+1)
+
+	attrs := []any{
+		"ref", o.ref.String(),
+		slog.Int("failures", o.backoff.failures),
+		"failing_since", o.backoff.since,
+		"retry_in", delay,
+		"error", err,
+	}
+	if o.backoff.failures < escalateAfter {
+		slog.Warn("failed to poll repository; retrying", attrs...)
+		return delay
+	}
+
+	slog.Error("repository polling keeps failing", attrs...)
+	if o.backoff.failures == escalateAfter && o.notifier != nil {
+		msg := fmt.Sprintf("forge: polling %s has failed %d times since %s: %s",
+			o.git.GetRawRepoURL(), o.backoff.failures, o.backoff.since.Format(time.RFC3339), err)
+		if err := o.notifier.Notify(msg); err != nil {
+			slog.Warn("failed to send notification", "error", err)
+		}
+	}
+	return delay
+}
+
+// succeed resets the backoff after a successful poll.
+func (o *Observer) succeed() {
+	if o.backoff.failures == 0 {
+		return
+	}
+	slog.Info("repository polling recovered",
+		"ref", o.ref.String(),
+		slog.Int("failures", o.backoff.failures),
+		"downtime", time.Since(o.backoff.since).Round(time.Second))
+	o.backoff = backoff{}
+}
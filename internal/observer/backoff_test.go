@@ -0,0 +1,74 @@
+// Forge - Automated Docker container deployment tool for VPS environments.
+// Monitors Git repositories and redeploys containers on new commits.
+// Copyright (C) 2025 Artemii Fedotov
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+package observer
+
+import (
+	"errors"
+	"smithery/forge/internal/clients/git"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeGit struct {
+	git.IGitClient
+}
+
+func (fakeGit) GetRawRepoURL() string {
+	return "https://github.com/acme/api"
+}
+
+type recordingNotifier struct {
+	messages []string
+}
+
+func (n *recordingNotifier) Notify(message string) error {
+	n.messages = append(n.messages, message)
+	return nil
+}
+
+func TestBackoffEscalation(t *testing.T) {
+	n := &recordingNotifier{}
+	o := New(ObserverParams{
+		Git:      fakeGit{},
+		Interval: time.Second,
+		Notifier: n,
+	}).(*Observer)
+
+	err := errors.New("connection refused")
+	for range escalateAfter + 2 {
+		if delay := o.fail(err); delay > maxBackoff {
+			t.Errorf("fail() = %s, want at most %s", delay, maxBackoff)
+		}
+	}
+	if len(n.messages) != 1 {
+		t.Fatalf("notified %d times, want once: %q", len(n.messages), n.messages)
+	}
+	if !strings.Contains(n.messages[0], "https://github.com/acme/api") ||
+		!strings.Contains(n.messages[0], "connection refused") {
+		t.Errorf("notification = %q, want the repository and the error", n.messages[0])
+	}
+
+	// failing again after a success starts over
+	o.succeed()
+	for range escalateAfter {
+		o.fail(err)
+	}
+	if len(n.messages) != 2 {
+		t.Errorf("notified %d times after new failures, want twice", len(n.messages))
+	}
+}
@@ -0,0 +1,66 @@
+// Forge - Automated Docker container deployment tool for VPS environments.
+// Monitors Git repositories and redeploys containers on new commits.
+// Copyright (C) 2025 Artemii Fedotov
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+package observer
+
+import (
+	"regexp"
+	"smithery/forge/internal/clients/git"
+)
+
+var (
+	skipDirective   = regexp.MustCompile(`(?i)\[(skip deploy|forge skip)\]`)
+	targetDirective = regexp.MustCompile(`(?i)\[deploy:\s*([\w.-]+)\s*\]`)
+	// overrideDirective deploys the commit outside deploy windows and freezes
+	overrideDirective = regexp.MustCompile(`(?i)\[(deploy now|forge override)\]`)
+)
+
+// Directive is an instruction to forge found in a commit message:
+// `[skip deploy]` or `[forge skip]` suppress the deploy, `[deploy: <env>]`
+// restricts it to the named environment.
+type Directive struct {
+	Commit      string
+	Raw         string
+	Skip        bool
+	Environment string
+}
+
+func ParseDirective(commit git.Commit) (Directive, bool) {
+	if m := skipDirective.FindString(commit.Message); m != "" {
+		return Directive{Commit: commit.SHA, Raw: m, Skip: true}, true
+	}
+	if m := targetDirective.FindStringSubmatch(commit.Message); m != nil {
+		return Directive{Commit: commit.SHA, Raw: m[0], Environment: m[1]}, true
+	}
+	return Directive{}, false
+}
+
+// IsOverride reports whether the commit asks to be deployed outside deploy
+// windows and freezes.
+func IsOverride(commit git.Commit) bool {
+	return overrideDirective.MatchString(commit.Message)
+}
+
+// findDirective returns the directive of the newest commit that has one.
+// Commits are expected in chronological order, as compare APIs return them.
+func findDirective(commits []git.Commit) (Directive, bool) {
+	for i := len(commits) - 1; i >= 0; i-- {
+		if d, ok := ParseDirective(commits[i]); ok {
+			return d, true
+		}
+	}
+	return Directive{}, false
+}
@@ -0,0 +1,59 @@
+// Forge - Automated Docker container deployment tool for VPS environments.
+// Monitors Git repositories and redeploys containers on new commits.
+// Copyright (C) 2025 Artemii Fedotov
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+package observer
+
+import "smithery/forge/internal/common"
+
+// PathFilter decides whether a set of changed files is worth a deploy. A
+// file is relevant when it matches one of Paths (any file does when Paths is
+// empty) and none of IgnorePaths.
+type PathFilter struct {
+	Paths       []string
+	IgnorePaths []string
+}
+
+func (f PathFilter) IsEmpty() bool {
+	return len(f.Paths) == 0 && len(f.IgnorePaths) == 0
+}
+
+// Relevant returns the first relevant file, if any.
+func (f PathFilter) Relevant(files []string) (string, bool) {
+	for _, file := range files {
+		if f.matches(file) {
+			return file, true
+		}
+	}
+	return "", false
+}
+
+func (f PathFilter) matches(file string) bool {
+	if anyMatch(f.IgnorePaths, file) {
+		return false
+	}
+	return len(f.Paths) == 0 || anyMatch(f.Paths, file)
+}
+
+// anyMatch treats malformed patterns as non-matching; they are rejected when
+// the config is parsed.
+func anyMatch(patterns []string, file string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := common.MatchGlob(pattern, file); ok {
+			return true
+		}
+	}
+	return false
+}
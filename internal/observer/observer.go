@@ -22,33 +22,64 @@ import (
 	"log/slog"
 	"net/url"
 	"smithery/forge/internal/clients/git"
-	"sync"
+	"smithery/forge/internal/events"
+	"smithery/forge/internal/notifier"
+	"smithery/forge/internal/state"
+	"strings"
 	"time"
 )
 
-var lastPushed time.Time = time.Now()
-
 type IObserver interface {
 	Observe(ctx context.Context, u *url.URL) error
+	// Trigger makes the observer poll now instead of waiting for the interval
+	Trigger()
 }
 
 type Observer struct {
-	subscriptions []func(context.Context) error
-	git           git.IGitClient
-	interval      time.Duration
+	project     string
+	bus         *events.Bus
+	git         git.IGitClient
+	ref         git.TrackedRef
+	filter      PathFilter
+	environment string
+	scanRange   bool
+	state       *state.State
+	interval    time.Duration
+	trigger     chan struct{}
+	throttled   bool
+	backoff     backoff
+	notifier    notifier.INotifier
 }
 
 type ObserverParams struct {
-	Git           git.IGitClient
-	Interval      time.Duration
-	Subscriptions []func(context.Context) error
+	// Project names the project in the events published
+	Project string
+	// Bus receives a ChangeDetected event for every commit to deploy
+	Bus         *events.Bus
+	Git         git.IGitClient
+	Ref         git.TrackedRef
+	Filter      PathFilter
+	Environment string
+	ScanRange   bool
+	State       *state.State
+	Interval    time.Duration
+	// Notifier, when set, is told about sustained polling failures
+	Notifier notifier.INotifier
 }
 
 func New(params ObserverParams) IObserver {
 	return &Observer{
-		git:           params.Git,
-		interval:      params.Interval,
-		subscriptions: params.Subscriptions,
+		project:     params.Project,
+		bus:         params.Bus,
+		git:         params.Git,
+		ref:         params.Ref,
+		filter:      params.Filter,
+		environment: params.Environment,
+		scanRange:   params.ScanRange,
+		state:       params.State,
+		interval:    params.Interval,
+		trigger:     make(chan struct{}, 1),
+		notifier:    params.Notifier,
 	}
 }
 
@@ -57,7 +88,8 @@ func (o *Observer) Observe(ctx context.Context, u *url.URL) error {
 	if u == nil {
 		return errors.New("URL cannot be nil")
 	}
-	slog.Info("observer started", "url", u.String())
+	slog.Info("observer started", "url", u.String(), "ref", o.ref.String())
+
 	slog.Debug("observing...")
 	for {
 		select {
@@ -66,36 +98,140 @@ func (o *Observer) Observe(ctx context.Context, u *url.URL) error {
 			return nil
 		default:
 			slog.Debug("default case triggered")
-			r, err := o.git.GetRepository(ctx)
+			change, err := o.poll(ctx)
 			if err != nil {
-				return err
+				if ctx.Err() != nil {
+					return nil
+				}
+				o.wait(ctx, max(o.fail(err), o.delay()))
+				continue
 			}
-			if r.PushedAt.After(lastPushed) {
-				slog.Debug("push triggered; notifying...",
-					"pushed_at", r.PushedAt.Format(time.DateTime),
-					"last_pushed", lastPushed.Format(time.DateTime),
-				)
-				o.notify(ctx)
-				lastPushed = r.PushedAt
-				slog.Debug("notification finished")
+			o.succeed()
+
+			if change != nil {
+				if err := o.bus.Publish(ctx, *change); err != nil {
+					slog.Error("failed to handle change",
+						"project", o.project, "sha", change.SHA, "error", err)
+				}
+				slog.Debug("change handled", "sha", change.SHA)
 			}
-			time.Sleep(o.interval)
+			o.wait(ctx, o.delay())
+		}
+	}
+}
+
+func (o *Observer) Trigger() {
+	// a pending trigger already covers this one
+	select {
+	case o.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// wait blocks for the delay, until a trigger arrives or the context is
+// cancelled.
+func (o *Observer) wait(ctx context.Context, delay time.Duration) {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	case <-o.trigger:
+		slog.Debug("poll triggered")
+	}
+}
+
+// poll returns a ChangeDetected event when the tracked ref points to a
+// commit other than the deployed one, or nil. A commit is reported on every
+// poll until a deploy of it has finished or it was skipped, so that a deploy
+// lost to a transient error is retried; the queue ignores the repeats.
+func (o *Observer) poll(ctx context.Context) (*events.Event, error) {
+	ref, err := git.ResolveRef(ctx, o.git, o.ref)
+	if err != nil {
+		return nil, err
+	}
+
+	commit, err := o.git.GetHeadCommit(ctx, ref.Short())
+	if err != nil {
+		return nil, err
+	}
+
+	deployed := o.state.Deployed()
+	if lastSeen, _ := o.state.LastSeen(); commit.SHA == deployed || commit.SHA == lastSeen {
+		return nil, nil
+	}
+
+	var cmp *git.Comparison
+	if (!o.filter.IsEmpty() || o.scanRange) && deployed != "" {
+		cmp, err = o.git.Compare(ctx, deployed, commit.SHA)
+		if err != nil {
+			// without the diff the change cannot be ruled out
+			slog.Warn("failed to compare commits; deploying anyway",
+				"base", deployed, "head", commit.SHA, "error", err)
+			cmp = nil
 		}
 	}
+
+	if !o.honourDirectives(*commit, cmp) {
+		o.state.SetLastSeen(commit.SHA)
+		return nil, nil
+	}
+
+	if !o.filter.IsEmpty() && cmp != nil && !cmp.Truncated {
+		file, ok := o.filter.Relevant(cmp.Files)
+		if !ok {
+			slog.Info("skipping deploy: no changed file matches the path filters",
+				"ref", ref.Short(), "sha", commit.SHA, "deployed", deployed,
+				slog.Int("changed_files", len(cmp.Files)))
+			o.state.SetLastSeen(commit.SHA)
+			return nil, nil
+		}
+		slog.Debug("matching file changed", "file", file)
+	}
+
+	slog.Debug("ref moved; publishing change...",
+		"ref", ref.Short(), "sha", commit.SHA, "deployed", deployed)
+	return &events.Event{
+		Type:     events.ChangeDetected,
+		Project:  o.project,
+		Ref:      ref.String(),
+		SHA:      commit.SHA,
+		Author:   commit.Author,
+		Override: IsOverride(*commit),
+	}, nil
 }
 
-func (o *Observer) notify(ctx context.Context) {
-	var wg sync.WaitGroup
-	wg.Add(len(o.subscriptions))
-	for idx, sub := range o.subscriptions {
-		go func() {
-			if err := sub(ctx); err != nil {
-				slog.Error("failed to notify", slog.Int("idx", idx), "error", err)
-				return
+// honourDirectives reports whether the head commit's directive allows the
+// deploy. A directive on an older commit would hold back the newer ones, so
+// with scanRange it is only logged.
+func (o *Observer) honourDirectives(head git.Commit, cmp *git.Comparison) bool {
+	directive, ok := ParseDirective(head)
+	if !ok {
+		if o.scanRange && cmp != nil {
+			if older, found := findDirective(cmp.Commits); found {
+				slog.Info("ignoring commit directive: newer commits follow it",
+					"sha", head.SHA, "directive", older.Raw, "directive_commit", older.Commit)
 			}
-			slog.Debug("notified", slog.Int("idx", idx))
-			wg.Done()
-		}()
+		}
+		return true
+	}
+
+	deploy := !directive.Skip && strings.EqualFold(directive.Environment, o.environment)
+	o.state.SetDirective(state.Directive{
+		Commit:   directive.Commit,
+		Text:     directive.Raw,
+		Deployed: deploy,
+	})
+
+	if !deploy {
+		slog.Info("skipping deploy: commit directive",
+			"sha", head.SHA, "directive", directive.Raw,
+			"directive_commit", directive.Commit, "environment", o.environment)
+		return false
 	}
-	wg.Wait()
+	slog.Info("deploying by commit directive",
+		"sha", head.SHA, "directive", directive.Raw,
+		"directive_commit", directive.Commit, "environment", o.environment)
+	return true
 }
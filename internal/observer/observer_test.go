@@ -0,0 +1,120 @@
+// Forge - Automated Docker container deployment tool for VPS environments.
+// Monitors Git repositories and redeploys containers on new commits.
+// Copyright (C) 2025 Artemii Fedotov
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+package observer
+
+import (
+	"context"
+	"smithery/forge/internal/clients/git"
+	"smithery/forge/internal/events"
+	"smithery/forge/internal/state"
+	"testing"
+)
+
+// repoGit serves a head commit and the files changed since the deployed one
+type repoGit struct {
+	fakeGit
+	head  git.Commit
+	files []string
+}
+
+func (g *repoGit) GetHeadCommit(context.Context, string) (*git.Commit, error) {
+	head := g.head
+	return &head, nil
+}
+
+func (g *repoGit) Compare(context.Context, string, string) (*git.Comparison, error) {
+	return &git.Comparison{Commits: []git.Commit{g.head}, Files: g.files}, nil
+}
+
+func newTestObserver(g *repoGit, st *state.State, filter PathFilter) *Observer {
+	return New(ObserverParams{
+		Project:     "api",
+		Git:         g,
+		Ref:         git.TrackedRef{Branch: "main"},
+		Filter:      filter,
+		Environment: "production",
+		State:       st,
+	}).(*Observer)
+}
+
+func TestPoll(t *testing.T) {
+	st := state.New()
+	st.SetDeployed("a")
+	g := &repoGit{head: git.Commit{SHA: "a", Author: "ada"}}
+	o := newTestObserver(g, st, PathFilter{})
+
+	if change, err := o.poll(context.Background()); err != nil || change != nil {
+		t.Fatalf("poll() of the deployed commit = %+v, %v, want nil", change, err)
+	}
+
+	g.head = git.Commit{SHA: "b", Author: "ada", Message: "Fix login [deploy now]"}
+	want := events.Event{
+		Type:     events.ChangeDetected,
+		Project:  "api",
+		Ref:      "refs/heads/main",
+		SHA:      "b",
+		Author:   "ada",
+		Override: true,
+	}
+	// until its deploy has finished, the commit is reported on every poll
+	for range 2 {
+		change, err := o.poll(context.Background())
+		if err != nil || change == nil || *change != want {
+			t.Fatalf("poll() = %+v, %v, want %+v", change, err, want)
+		}
+	}
+
+	st.SetLastSeen("b")
+	if change, err := o.poll(context.Background()); err != nil || change != nil {
+		t.Errorf("poll() of the last seen commit = %+v, %v, want nil", change, err)
+	}
+}
+
+func TestPollSkips(t *testing.T) {
+	tests := map[string]struct {
+		head   git.Commit
+		files  []string
+		filter PathFilter
+	}{
+		"skip directive": {
+			head: git.Commit{SHA: "b", Message: "Update docs [skip deploy]"},
+		},
+		"other environment": {
+			head: git.Commit{SHA: "b", Message: "Try it out [deploy: staging]"},
+		},
+		"no matching file": {
+			head:   git.Commit{SHA: "b", Message: "Update docs"},
+			files:  []string{"docs/README.md"},
+			filter: PathFilter{IgnorePaths: []string{"docs/**"}},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			st := state.New()
+			st.SetDeployed("a")
+			o := newTestObserver(&repoGit{head: tt.head, files: tt.files}, st, tt.filter)
+
+			if change, err := o.poll(context.Background()); err != nil || change != nil {
+				t.Fatalf("poll() = %+v, %v, want nil", change, err)
+			}
+			// a skipped commit is not looked at again
+			if seen, _ := st.LastSeen(); seen != "b" {
+				t.Errorf("LastSeen() = %q, want b", seen)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+// Forge - Automated Docker container deployment tool for VPS environments.
+// Monitors Git repositories and redeploys containers on new commits.
+// Copyright (C) 2025 Artemii Fedotov
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+package observer
+
+import (
+	"log/slog"
+	"time"
+)
+
+const (
+	// lowRateLimit is the share of the API quota below which polling slows
+	lowRateLimit = 0.1
+	// requestsPerPoll is roughly how many API requests a poll costs
+	requestsPerPoll = 3
+)
+
+// delay returns how long to wait before the next poll. With the API quota
+// running low, the remaining requests are spread until the quota resets.
+func (o *Observer) delay() time.Duration {
+	limit := o.git.RateLimit()
+	now := time.Now()
+
+	delay := o.interval
+	switch {
+	case limit.RetryAfter.After(now):
+		delay = max(delay, limit.RetryAfter.Sub(now))
+	case limit.Limit == 0 || !limit.Reset.After(now):
+	case float64(limit.Remaining) < float64(limit.Limit)*lowRateLimit:
+		if polls := limit.Remaining / requestsPerPoll; polls > 0 {
+			delay = max(delay, limit.Reset.Sub(now)/time.Duration(polls))
+		} else {
+			delay = max(delay, limit.Reset.Sub(now))
+		}
+	}
+
+	throttled := delay > o.interval
+	if throttled && !o.throttled {
+		slog.Warn("api rate limit is running low; polling less often",
+			slog.Int("limit", limit.Limit),
+			slog.Int("remaining", limit.Remaining),
+			"reset", limit.Reset,
+			"retry_after", limit.RetryAfter,
+			"interval", delay,
+		)
+	} else if !throttled && o.throttled {
+		slog.Info("api rate limit recovered; polling at the configured interval",
+			slog.Int("remaining", limit.Remaining), "interval", o.interval)
+	}
+	o.throttled = throttled
+	return delay
+}
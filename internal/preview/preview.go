@@ -0,0 +1,302 @@
+// Forge - Automated Docker container deployment tool for VPS environments.
+// Monitors Git repositories and redeploys containers on new commits.
+// Copyright (C) 2025 Artemii Fedotov
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+package preview
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"smithery/forge/internal/clients/git"
+	"smithery/forge/internal/common"
+	"smithery/forge/internal/deployer"
+	"time"
+)
+
+// Label marks preview containers; its value is the project they belong to
+const Label = "forge.preview"
+
+// Manager keeps one preview container per open pull request. Previews are
+// named `<project>-pr-<number>` and published on BasePort + the PR number
+// modulo PortRange, so they survive restarts without any state of their own.
+type Manager struct {
+	project       string
+	deployer      deployer.IDeployer
+	git           git.IGitClient
+	clone         git.CloneParams
+	signature     *git.SignaturePolicy
+	max           int
+	basePort      int
+	portRange     int
+	containerPort int
+	forks         bool
+	interval      time.Duration
+	grace         time.Duration
+	// failed holds the head SHA a preview failed to deploy at, so that it is
+	// not rebuilt on every poll
+	failed map[string]string
+}
+
+type ManagerParams struct {
+	// Project names the previews and labels them
+	Project  string
+	Deployer deployer.IDeployer
+	Git      git.IGitClient
+	// Clone holds the clone options; every preview is cloned into a
+	// directory of its own under Clone.Dir
+	Clone     git.CloneParams
+	Signature *git.SignaturePolicy
+	Max       int
+	BasePort  int
+	// PortRange is the number of host ports from BasePort on that previews
+	// are published on
+	PortRange     int
+	ContainerPort int
+	// Forks allows previews of pull requests from forks, which run code
+	// from outside the repository
+	Forks    bool
+	Interval time.Duration
+	// GracePeriod is how long a preview deploy in progress may carry on
+	// after the context is cancelled
+	GracePeriod time.Duration
+}
+
+func New(params ManagerParams) *Manager {
+	return &Manager{
+		project:       params.Project,
+		deployer:      params.Deployer,
+		git:           params.Git,
+		clone:         params.Clone,
+		signature:     params.Signature,
+		max:           params.Max,
+		basePort:      params.BasePort,
+		portRange:     params.PortRange,
+		containerPort: params.ContainerPort,
+		forks:         params.Forks,
+		interval:      params.Interval,
+		grace:         params.GracePeriod,
+		failed:        make(map[string]string),
+	}
+}
+
+// Run reconciles the previews every interval until the context is cancelled.
+func (m *Manager) Run(ctx context.Context) {
+	slog.Info("preview manager started",
+		slog.Int("max", m.max), slog.Int("base_port", m.basePort))
+
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		if err := m.Reconcile(ctx); err != nil && ctx.Err() == nil {
+			slog.Error("failed to reconcile previews", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Reconcile deploys previews for new and updated pull requests and removes
+// those of pull requests that were closed or merged.
+func (m *Manager) Reconcile(ctx context.Context) error {
+	pulls, err := m.git.ListPullRequests(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list pull requests: %w", err)
+	}
+
+	deployed, err := m.deployer.Deployed(ctx, m.label())
+	if err != nil {
+		return fmt.Errorf("failed to list previews: %w", err)
+	}
+
+	var errs []error
+	wanted := make(map[string]bool)
+	for _, pr := range m.selectPulls(pulls, deployed) {
+		name := m.containerName(pr.Number)
+		wanted[name] = true
+		if deployed[name] == pr.SHA || m.failed[name] == pr.SHA {
+			continue
+		}
+		// no deploy is started once shutting down
+		if ctx.Err() != nil {
+			return errors.Join(append(errs, ctx.Err())...)
+		}
+
+		if err := m.deploy(ctx, name, pr); err != nil {
+			m.failed[name] = pr.SHA
+			errs = append(errs, fmt.Errorf("preview of #%d: %w", pr.Number, err))
+			continue
+		}
+		delete(m.failed, name)
+	}
+
+	for name := range deployed {
+		if wanted[name] {
+			continue
+		}
+		if err := m.remove(ctx, name); err != nil {
+			errs = append(errs, fmt.Errorf("preview %s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Teardown removes every preview of the repository.
+func (m *Manager) Teardown(ctx context.Context) error {
+	deployed, err := m.deployer.Deployed(ctx, m.label())
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for name := range deployed {
+		errs = append(errs, m.remove(ctx, name))
+	}
+	return errors.Join(errs...)
+}
+
+// selectPulls returns the pull requests to preview: running previews are
+// kept, and free slots go to the newest pull requests. Of pull requests
+// whose numbers map to the same host port, only the first gets a preview.
+func (m *Manager) selectPulls(pulls []git.PullRequest, deployed map[string]string) []git.PullRequest {
+	var candidates []git.PullRequest
+	for _, pr := range pulls {
+		if pr.Fork && !m.forks {
+			slog.Debug("skipping preview: pull request is from a fork", slog.Int("number", pr.Number))
+			continue
+		}
+		candidates = append(candidates, pr)
+	}
+
+	slices.SortFunc(candidates, func(a, b git.PullRequest) int {
+		_, aLive := deployed[m.containerName(a.Number)]
+		_, bLive := deployed[m.containerName(b.Number)]
+		if aLive != bLive {
+			if aLive {
+				return -1
+			}
+			return 1
+		}
+		return cmp.Compare(b.Number, a.Number)
+	})
+
+	ports := make(map[int]int)
+	candidates = slices.DeleteFunc(candidates, func(pr git.PullRequest) bool {
+		port := m.hostPort(pr.Number)
+		if other, ok := ports[port]; ok {
+			slog.Warn("skipping preview: host port taken by another pull request",
+				slog.Int("number", pr.Number), slog.Int("other", other), slog.Int("host_port", port))
+			return true
+		}
+		ports[port] = pr.Number
+		return false
+	})
+
+	if len(candidates) > m.max {
+		for _, pr := range candidates[m.max:] {
+			slog.Info("skipping preview: limit reached",
+				slog.Int("number", pr.Number), slog.Int("max", m.max))
+		}
+		candidates = candidates[:m.max]
+	}
+	return candidates
+}
+
+func (m *Manager) deploy(ctx context.Context, name string, pr git.PullRequest) error {
+	ctx, cancel := common.WithGrace(ctx, m.grace)
+	defer cancel()
+
+	slog.Info("deploying preview",
+		slog.Int("number", pr.Number), "title", pr.Title, "author", pr.Author, "sha", pr.SHA)
+
+	clone := m.clone
+	clone.Dir = filepath.Join(m.clone.Dir, name)
+	clone.URL = m.git.GetRawRepoURL()
+	clone.Ref = pr.Ref
+
+	var err error
+	if clone.AccessToken, err = m.git.GetAccessToken(ctx); err != nil {
+		return err
+	}
+	if clone.SSHKey != nil {
+		if clone.URL, err = git.SSHRepoURL(clone.URL); err != nil {
+			return err
+		}
+	}
+	// each preview has a clone dir of its own, created on first deploy
+	if err := os.MkdirAll(clone.Dir, 0755); err != nil {
+		return err
+	}
+	if err := m.git.Sync(ctx, clone); err != nil {
+		return err
+	}
+
+	revision, err := git.HeadSHA(clone.Dir)
+	if err != nil {
+		return err
+	}
+
+	if m.signature != nil {
+		if err := git.VerifyHeadSignature(clone.Dir, *m.signature); err != nil {
+			slog.Error("refusing to deploy preview", "revision", revision, "error", err)
+			return err
+		}
+	}
+
+	err = m.deployer.Deploy(ctx, deployer.DeployParams{
+		ContainerName: name,
+		BuildDir:      clone.Dir,
+		Revision:      revision,
+		Labels:        map[string]string{Label: m.project},
+		HostPort:      m.hostPort(pr.Number),
+		ContainerPort: m.containerPort,
+	})
+	if err != nil {
+		return err
+	}
+	slog.Info("preview deployed",
+		slog.Int("number", pr.Number), "revision", revision, slog.Int("host_port", m.hostPort(pr.Number)))
+	return nil
+}
+
+func (m *Manager) remove(ctx context.Context, name string) error {
+	if err := m.deployer.Remove(ctx, name); err != nil {
+		return err
+	}
+	delete(m.failed, name)
+	slog.Info("preview removed", "container_name", name)
+	return os.RemoveAll(filepath.Join(m.clone.Dir, name))
+}
+
+func (m *Manager) label() string {
+	return Label + "=" + m.project
+}
+
+func (m *Manager) containerName(number int) string {
+	return fmt.Sprintf("%s-pr-%d", m.project, number)
+}
+
+func (m *Manager) hostPort(number int) int {
+	return m.basePort + number%m.portRange
+}
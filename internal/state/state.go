@@ -0,0 +1,260 @@
+// Forge - Automated Docker container deployment tool for VPS environments.
+// Monitors Git repositories and redeploys containers on new commits.
+// Copyright (C) 2025 Artemii Fedotov
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// State holds what forge knows about a project's deployments. It is shared
+// by the observer, which reads it to detect changes, and the deploy invoker,
+// which updates it. A state loaded from a file is written back to it on
+// every change, so that a restart picks up where forge left off.
+type State struct {
+	mu   sync.RWMutex
+	path string
+	data data
+}
+
+// data is the persisted form of the state
+type data struct {
+	Deployed   string    `json:"deployed,omitempty"`
+	LastSeen   string    `json:"last_seen,omitempty"`
+	LastSeenAt time.Time `json:"last_seen_at,omitzero"`
+	// Deploying is the revision being deployed; it is left behind when forge
+	// stops mid-deploy
+	Deploying      string    `json:"deploying,omitempty"`
+	DeployingSince time.Time `json:"deploying_since,omitzero"`
+	// Queued is the revision waiting for the deploy in progress to finish
+	Queued     string      `json:"queued,omitempty"`
+	LastResult *Result     `json:"last_result,omitempty"`
+	Directive  Directive   `json:"directive,omitzero"`
+	Pending    *Deployment `json:"pending_deployment,omitempty"`
+	Live       *Deployment `json:"live_deployment,omitempty"`
+	// BaseImages maps the base images of the deployed Dockerfile to the
+	// digests their tags last resolved to
+	BaseImages map[string]string `json:"base_images,omitempty"`
+}
+
+// Directive is the last commit message directive forge acted on.
+type Directive struct {
+	Commit   string `json:"commit"`
+	Text     string `json:"text"`
+	Deployed bool   `json:"deployed"`
+}
+
+// Result is the outcome of a deploy.
+type Result struct {
+	Revision string    `json:"revision"`
+	Success  bool      `json:"success"`
+	Error    string    `json:"error,omitempty"`
+	At       time.Time `json:"at"`
+}
+
+// Deployment is a deployment recorded with the git provider.
+type Deployment struct {
+	Id          int64  `json:"id"`
+	SHA         string `json:"sha"`
+	Environment string `json:"environment"`
+}
+
+func New() *State {
+	return &State{}
+}
+
+// Load reads the state from the file, which need not exist yet.
+func Load(path string) (*State, error) {
+	s := &State{path: path}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+
+	if err := json.Unmarshal(b, &s.data); err != nil {
+		return nil, fmt.Errorf("failed to parse state file (%s): %w", path, err)
+	}
+	return s, nil
+}
+
+// Deployed returns the commit SHA that was last deployed successfully.
+func (s *State) Deployed() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.data.Deployed
+}
+
+func (s *State) SetDeployed(sha string) {
+	s.update(func(d *data) { d.Deployed = sha })
+}
+
+// LastSeen returns the last commit SHA the observer reported, and when.
+func (s *State) LastSeen() (string, time.Time) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.data.LastSeen, s.data.LastSeenAt
+}
+
+func (s *State) SetLastSeen(sha string) {
+	s.update(func(d *data) {
+		d.LastSeen = sha
+		d.LastSeenAt = time.Now()
+	})
+}
+
+// Deploying returns the revision being deployed, if any.
+func (s *State) Deploying() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.data.Deploying
+}
+
+// Queued returns the revision waiting to be deployed, if any.
+func (s *State) Queued() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.data.Queued
+}
+
+func (s *State) SetQueued(revision string) {
+	s.update(func(d *data) { d.Queued = revision })
+}
+
+func (s *State) StartDeploy(revision string) {
+	s.update(func(d *data) {
+		d.Deploying = revision
+		d.DeployingSince = time.Now()
+	})
+}
+
+// FinishDeploy records the result of the deploy started last; a successful
+// one becomes the deployed revision.
+func (s *State) FinishDeploy(revision string, err error) {
+	s.update(func(d *data) {
+		result := &Result{Revision: revision, Success: err == nil, At: time.Now()}
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			d.Deployed = revision
+		}
+		d.LastResult = result
+		d.Deploying = ""
+		d.DeployingSince = time.Time{}
+	})
+}
+
+func (s *State) LastResult() *Result {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.data.LastResult
+}
+
+func (s *State) Directive() Directive {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.data.Directive
+}
+
+func (s *State) SetDirective(directive Directive) {
+	s.update(func(d *data) { d.Directive = directive })
+}
+
+// PendingDeployment returns the provider deployment being rolled out.
+func (s *State) PendingDeployment() *Deployment {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.data.Pending
+}
+
+func (s *State) SetPendingDeployment(deployment *Deployment) {
+	s.update(func(d *data) { d.Pending = deployment })
+}
+
+// LiveDeployment returns the provider deployment currently running.
+func (s *State) LiveDeployment() *Deployment {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.data.Live
+}
+
+func (s *State) SetLiveDeployment(deployment *Deployment) {
+	s.update(func(d *data) { d.Live = deployment })
+}
+
+// BaseImages returns the last known digests of the base images.
+func (s *State) BaseImages() map[string]string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return maps.Clone(s.data.BaseImages)
+}
+
+func (s *State) SetBaseImages(digests map[string]string) {
+	s.update(func(d *data) { d.BaseImages = maps.Clone(digests) })
+}
+
+// update applies the change and persists the state. Failing to persist is
+// logged rather than returned, since the state in memory remains correct.
+func (s *State) update(change func(*data)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	change(&s.data)
+	if s.path == "" {
+		return
+	}
+	if err := s.save(); err != nil {
+		slog.Warn("failed to save state", "path", s.path, "error", err)
+	}
+}
+
+// save writes the state to a temporary file and renames it over the state
+// file, so that the file is never left half written.
+func (s *State) save() error {
+	b, err := json.MarshalIndent(s.data, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
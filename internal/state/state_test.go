@@ -0,0 +1,92 @@
+// Forge - Automated Docker container deployment tool for VPS environments.
+// Monitors Git repositories and redeploys containers on new commits.
+// Copyright (C) 2025 Artemii Fedotov
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+package state
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadMissingFile(t *testing.T) {
+	s, err := Load(filepath.Join(t.TempDir(), "api.json"))
+	if err != nil {
+		t.Fatalf("Load() = %v", err)
+	}
+	if s.Deployed() != "" || s.LastResult() != nil {
+		t.Errorf("Load() of a missing file = %+v, want an empty state", s.data)
+	}
+}
+
+func TestSaveLoadRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api.json")
+	s, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.SetDeployed("a")
+	s.SetLastSeen("c")
+	s.StartDeploy("b")
+	s.FinishDeploy("b", errors.New("build failed"))
+	s.StartDeploy("c")
+	s.SetDirective(Directive{Commit: "c", Text: "[skip deploy]"})
+	s.SetLiveDeployment(&Deployment{Id: 7, SHA: "a", Environment: "production"})
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() = %v", err)
+	}
+	if got := loaded.Deployed(); got != "a" {
+		t.Errorf("Deployed() = %q, want a", got)
+	}
+	if got, at := loaded.LastSeen(); got != "c" || at.IsZero() {
+		t.Errorf("LastSeen() = %q, %v, want c with its time", got, at)
+	}
+	// the deploy cut short is left for the next start to retry
+	if got := loaded.Deploying(); got != "c" {
+		t.Errorf("Deploying() = %q, want c", got)
+	}
+	if r := loaded.LastResult(); r == nil || r.Revision != "b" || r.Success || r.Error != "build failed" {
+		t.Errorf("LastResult() = %+v, want the failed deploy of b", r)
+	}
+	if d := loaded.Directive(); d != (Directive{Commit: "c", Text: "[skip deploy]"}) {
+		t.Errorf("Directive() = %+v", d)
+	}
+	if d := loaded.LiveDeployment(); d == nil || *d != (Deployment{Id: 7, SHA: "a", Environment: "production"}) {
+		t.Errorf("LiveDeployment() = %+v", d)
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("state dir holds %d files, want only the state file", len(entries))
+	}
+}
+
+func TestLoadCorruptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api.json")
+	if err := os.WriteFile(path, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Error("Load() of a corrupt file = nil, want an error")
+	}
+}
@@ -0,0 +1,327 @@
+// Forge - Automated Docker container deployment tool for VPS environments.
+// Monitors Git repositories and redeploys containers on new commits.
+// Copyright (C) 2025 Artemii Fedotov
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"path"
+	"smithery/forge/internal/clients/git"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+const (
+	maxPayloadSize    = 5 << 20 // 5 MiB
+	readHeaderTimeout = 10 * time.Second
+	shutdownTimeout   = 5 * time.Second
+)
+
+var (
+	errBadSignature = errors.New("invalid webhook signature")
+	errUnknownEvent = errors.New("unknown webhook event")
+	errBadToken     = errors.New("invalid bearer token")
+)
+
+// Project is a repository forge deploys from. Pushes to its tracked ref
+// call Trigger.
+type Project struct {
+	Name string
+	// Host is the git provider, `github.com` or `gitlab.com`
+	Host string
+	// Repository is the repository path, `owner/name`
+	Repository string
+	Ref        git.TrackedRef
+	Secret     string
+	Trigger    func()
+	// Status reports the project's deploy queue
+	Status func() QueueStatus
+}
+
+// push is what forge needs to know about a push, whichever provider sent it
+type push struct {
+	host          string
+	repository    string
+	ref           plumbing.ReferenceName
+	defaultBranch string
+	sha           string
+}
+
+type Server struct {
+	addr     string
+	path     string
+	projects []Project
+}
+
+type ServerParams struct {
+	Address  string
+	Path     string
+	Projects []Project
+}
+
+func New(params ServerParams) *Server {
+	return &Server{
+		addr:     params.Address,
+		path:     params.Path,
+		projects: params.Projects,
+	}
+}
+
+// Run serves webhooks until the context is cancelled.
+func (s *Server) Run(ctx context.Context) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+s.path, s.handle)
+	mux.HandleFunc("GET "+path.Join(s.path, "status"), s.status)
+
+	srv := &http.Server{
+		Addr:              s.addr,
+		Handler:           mux,
+		ReadHeaderTimeout: readHeaderTimeout,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		slog.Info("webhook server started", "address", s.addr, "path", s.path)
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		return srv.Shutdown(shutdownCtx)
+	}
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPayloadSize))
+	if err != nil {
+		http.Error(w, "payload too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var p *push
+	var verify func(secret string) bool
+	switch {
+	case r.Header.Get("X-GitHub-Event") != "":
+		p, err = parseGitHub(r.Header.Get("X-GitHub-Event"), body)
+		verify = func(secret string) bool {
+			return verifyGitHub(secret, r.Header.Get("X-Hub-Signature-256"), body)
+		}
+	case r.Header.Get("X-Gitlab-Event") != "":
+		p, err = parseGitLab(r.Header.Get("X-Gitlab-Event"), body)
+		verify = func(secret string) bool {
+			return verifyGitLab(secret, r.Header.Get("X-Gitlab-Token"))
+		}
+	default:
+		err = errUnknownEvent
+	}
+	if err != nil {
+		slog.Warn("webhook rejected", "remote_addr", r.RemoteAddr, "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// events other than pushes, such as GitHub's ping, are acknowledged
+	if p == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	project := s.find(p.host, p.repository)
+	if project == nil || !verify(project.Secret) {
+		// unknown repositories get the same answer as bad signatures, so
+		// that the configured ones cannot be probed for
+		slog.Warn("webhook rejected",
+			"remote_addr", r.RemoteAddr, "repository", p.repository, "error", errBadSignature)
+		http.Error(w, errBadSignature.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if !project.Ref.Matches(p.ref, p.defaultBranch) {
+		slog.Debug("webhook ignored: ref is not tracked",
+			"repository", p.repository, "ref", p.ref.String(), "tracked", project.Ref.String())
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	slog.Info("push received",
+		"repository", p.repository, "ref", p.ref.String(), "sha", p.sha)
+	project.Trigger()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// Change is a queued or running change as the status endpoint reports it
+type Change struct {
+	Type   string `json:"type"`
+	SHA    string `json:"sha,omitempty"`
+	Author string `json:"author,omitempty"`
+}
+
+// QueueStatus is the state of a project's deploy queue.
+type QueueStatus struct {
+	Project      string    `json:"project"`
+	Running      *Change   `json:"running,omitempty"`
+	RunningSince time.Time `json:"running_since,omitzero"`
+	Pending      *Change   `json:"pending,omitempty"`
+	Fresh        bool      `json:"fresh,omitempty"`
+	Coalesced    int       `json:"coalesced,omitempty"`
+	SettlesAt    time.Time `json:"settles_at,omitzero"`
+	Held         bool      `json:"held,omitempty"`
+	HeldUntil    time.Time `json:"held_until,omitzero"`
+	HeldReason   string    `json:"held_reason,omitempty"`
+}
+
+// status reports the deploy queues of the projects whose webhook secret the
+// request carries as a bearer token.
+func (s *Server) status(w http.ResponseWriter, r *http.Request) {
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	var statuses []QueueStatus
+	for _, p := range s.projects {
+		if p.Status == nil || !verifyToken(p.Secret, token) {
+			continue
+		}
+		status := p.Status()
+		status.Project = p.Name
+		statuses = append(statuses, status)
+	}
+	if statuses == nil {
+		http.Error(w, errBadToken.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(statuses); err != nil {
+		slog.Warn("failed to write queue status", "remote_addr", r.RemoteAddr, "error", err)
+	}
+}
+
+func (s *Server) find(host, repository string) *Project {
+	for i := range s.projects {
+		if s.projects[i].Host == host && strings.EqualFold(s.projects[i].Repository, repository) {
+			return &s.projects[i]
+		}
+	}
+	return nil
+}
+
+type gitHubPush struct {
+	Ref        string `json:"ref"`
+	After      string `json:"after"`
+	Deleted    bool   `json:"deleted"`
+	Repository struct {
+		FullName      string `json:"full_name"`
+		DefaultBranch string `json:"default_branch"`
+	} `json:"repository"`
+}
+
+func parseGitHub(event string, body []byte) (*push, error) {
+	switch event {
+	case "ping":
+		return nil, nil
+	case "push":
+	default:
+		return nil, errUnknownEvent
+	}
+
+	var payload gitHubPush
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+	if payload.Deleted {
+		return nil, nil
+	}
+	return &push{
+		host:          "github.com",
+		repository:    payload.Repository.FullName,
+		ref:           plumbing.ReferenceName(payload.Ref),
+		defaultBranch: payload.Repository.DefaultBranch,
+		sha:           payload.After,
+	}, nil
+}
+
+func verifyGitHub(secret, signature string, body []byte) bool {
+	sig, ok := strings.CutPrefix(signature, "sha256=")
+	if !ok {
+		return false
+	}
+	got, err := hex.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+type gitLabPush struct {
+	Ref         string  `json:"ref"`
+	CheckoutSHA *string `json:"checkout_sha"`
+	Project     struct {
+		PathWithNamespace string `json:"path_with_namespace"`
+		DefaultBranch     string `json:"default_branch"`
+	} `json:"project"`
+}
+
+func parseGitLab(event string, body []byte) (*push, error) {
+	switch event {
+	case "Push Hook", "Tag Push Hook":
+	default:
+		return nil, errUnknownEvent
+	}
+
+	var payload gitLabPush
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+	// deleted refs have no checkout SHA
+	if payload.CheckoutSHA == nil {
+		return nil, nil
+	}
+	return &push{
+		host:          "gitlab.com",
+		repository:    payload.Project.PathWithNamespace,
+		ref:           plumbing.ReferenceName(payload.Ref),
+		defaultBranch: payload.Project.DefaultBranch,
+		sha:           *payload.CheckoutSHA,
+	}, nil
+}
+
+func verifyGitLab(secret, token string) bool {
+	return verifyToken(secret, token)
+}
+
+// verifyToken compares a secret sent as is
+func verifyToken(secret, token string) bool {
+	return token != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(token)) == 1
+}
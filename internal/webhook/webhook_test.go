@@ -0,0 +1,187 @@
+// Forge - Automated Docker container deployment tool for VPS environments.
+// Monitors Git repositories and redeploys containers on new commits.
+// Copyright (C) 2025 Artemii Fedotov
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"smithery/forge/internal/clients/git"
+	"strings"
+	"testing"
+)
+
+const (
+	gitHubPayload = `{"ref":"refs/heads/main","after":"abc","repository":{"full_name":"acme/api","default_branch":"main"}}`
+	gitLabPayload = `{"ref":"refs/heads/main","checkout_sha":"abc","project":{"path_with_namespace":"acme/web","default_branch":"main"}}`
+)
+
+func newTestServer(triggered map[string]int) *Server {
+	project := func(host, repository string) Project {
+		return Project{
+			Host:       host,
+			Repository: repository,
+			Ref:        git.TrackedRef{Branch: "main"},
+			Secret:     "s3cret",
+			Trigger:    func() { triggered[repository]++ },
+		}
+	}
+	return New(ServerParams{
+		Path: "/webhook",
+		Projects: []Project{
+			project("github.com", "acme/api"),
+			project("gitlab.com", "acme/web"),
+		},
+	})
+}
+
+func gitHubSignature(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestHandle(t *testing.T) {
+	tests := map[string]struct {
+		headers map[string]string
+		body    string
+		code    int
+		trigger string
+	}{
+		"github push": {
+			headers: map[string]string{
+				"X-GitHub-Event":      "push",
+				"X-Hub-Signature-256": gitHubSignature("s3cret", gitHubPayload),
+			},
+			body: gitHubPayload, code: http.StatusAccepted, trigger: "acme/api",
+		},
+		"github wrong secret": {
+			headers: map[string]string{
+				"X-GitHub-Event":      "push",
+				"X-Hub-Signature-256": gitHubSignature("guess", gitHubPayload),
+			},
+			body: gitHubPayload, code: http.StatusUnauthorized,
+		},
+		"github signature of another body": {
+			headers: map[string]string{
+				"X-GitHub-Event":      "push",
+				"X-Hub-Signature-256": gitHubSignature("s3cret", "{}"),
+			},
+			body: gitHubPayload, code: http.StatusUnauthorized,
+		},
+		"github unsigned": {
+			headers: map[string]string{"X-GitHub-Event": "push"},
+			body:    gitHubPayload, code: http.StatusUnauthorized,
+		},
+		"github unknown repository": {
+			headers: map[string]string{
+				"X-GitHub-Event":      "push",
+				"X-Hub-Signature-256": gitHubSignature("s3cret", strings.Replace(gitHubPayload, "acme/api", "acme/other", 1)),
+			},
+			body: strings.Replace(gitHubPayload, "acme/api", "acme/other", 1), code: http.StatusUnauthorized,
+		},
+		"github untracked branch": {
+			headers: map[string]string{
+				"X-GitHub-Event":      "push",
+				"X-Hub-Signature-256": gitHubSignature("s3cret", strings.Replace(gitHubPayload, "heads/main", "heads/dev", 1)),
+			},
+			body: strings.Replace(gitHubPayload, "heads/main", "heads/dev", 1), code: http.StatusAccepted,
+		},
+		"github ping": {
+			headers: map[string]string{"X-GitHub-Event": "ping"},
+			body:    `{}`, code: http.StatusNoContent,
+		},
+		"gitlab push": {
+			headers: map[string]string{"X-Gitlab-Event": "Push Hook", "X-Gitlab-Token": "s3cret"},
+			body:    gitLabPayload, code: http.StatusAccepted, trigger: "acme/web",
+		},
+		"gitlab wrong token": {
+			headers: map[string]string{"X-Gitlab-Event": "Push Hook", "X-Gitlab-Token": "guess"},
+			body:    gitLabPayload, code: http.StatusUnauthorized,
+		},
+		"gitlab no token": {
+			headers: map[string]string{"X-Gitlab-Event": "Push Hook"},
+			body:    gitLabPayload, code: http.StatusUnauthorized,
+		},
+		"unknown provider": {
+			body: gitHubPayload, code: http.StatusBadRequest,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			triggered := make(map[string]int)
+			s := newTestServer(triggered)
+
+			req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(tt.body))
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			s.handle(rec, req)
+
+			if rec.Code != tt.code {
+				t.Errorf("handle() = %d, want %d", rec.Code, tt.code)
+			}
+			want := map[string]int{}
+			if tt.trigger != "" {
+				want[tt.trigger] = 1
+			}
+			if len(triggered) != len(want) || triggered[tt.trigger] != want[tt.trigger] {
+				t.Errorf("triggered = %v, want %v", triggered, want)
+			}
+		})
+	}
+}
+
+func TestStatus(t *testing.T) {
+	s := New(ServerParams{
+		Path: "/webhook",
+		Projects: []Project{
+			{Name: "api", Secret: "one", Status: func() QueueStatus {
+				return QueueStatus{Running: &Change{Type: "change_detected", SHA: "abc"}}
+			}},
+			{Name: "web", Secret: "two", Status: func() QueueStatus { return QueueStatus{} }},
+		},
+	})
+
+	status := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/webhook/status", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		s.status(rec, req)
+		return rec
+	}
+
+	rec := status("one")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status() = %d, want 200", rec.Code)
+	}
+	want := `[{"project":"api","running":{"type":"change_detected","sha":"abc"}}]`
+	if got := strings.TrimSpace(rec.Body.String()); got != want {
+		t.Errorf("status() body = %s, want %s", got, want)
+	}
+
+	for _, token := range []string{"", "three"} {
+		if rec := status(token); rec.Code != http.StatusUnauthorized {
+			t.Errorf("status() with token %q = %d, want 401", token, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+// Forge - Automated Docker container deployment tool for VPS environments.
+// Monitors Git repositories and redeploys containers on new commits.
+// Copyright (C) 2025 Artemii Fedotov
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+package window
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// maxSteps bounds the search for the next opening of a schedule
+const maxSteps = 1000
+
+// Schedule tells when deploys are allowed: inside one of the windows, if
+// any are set, and outside every freeze.
+type Schedule struct {
+	Location *time.Location
+	Windows  []Window
+	Freezes  []Freeze
+	// AllowOverride lets a commit directive deploy outside the schedule
+	AllowOverride bool
+}
+
+// Window is a daily time range on the given weekdays. A window ending at or
+// before its start runs past midnight into the next day.
+type Window struct {
+	Days []time.Weekday
+	// From and To are offsets from midnight
+	From time.Duration
+	To   time.Duration
+}
+
+// Freeze is a period in which nothing is deployed; To is exclusive.
+type Freeze struct {
+	From   time.Time
+	To     time.Time
+	Reason string
+}
+
+// Allows reports whether deploying at t is allowed, and if not, why.
+func (s *Schedule) Allows(t time.Time) (bool, string) {
+	if f := s.freeze(t); f != nil {
+		if f.Reason != "" {
+			return false, fmt.Sprintf("change freeze until %s: %s", f.To.In(s.Location).Format(time.DateTime), f.Reason)
+		}
+		return false, fmt.Sprintf("change freeze until %s", f.To.In(s.Location).Format(time.DateTime))
+	}
+	if len(s.Windows) > 0 && !s.inWindow(t) {
+		return false, "outside deploy windows"
+	}
+	return true, ""
+}
+
+// Next returns the earliest time from t on at which deploying is allowed,
+// or the zero time if the schedule never opens.
+func (s *Schedule) Next(t time.Time) time.Time {
+	for range maxSteps {
+		if ok, _ := s.Allows(t); ok {
+			return t
+		}
+
+		if f := s.freeze(t); f != nil {
+			t = f.To
+			continue
+		}
+		next, ok := s.nextStart(t)
+		if !ok {
+			return time.Time{}
+		}
+		t = next
+	}
+	return time.Time{}
+}
+
+func (s *Schedule) freeze(t time.Time) *Freeze {
+	for i := range s.Freezes {
+		f := &s.Freezes[i]
+		if !t.Before(f.From) && t.Before(f.To) {
+			return f
+		}
+	}
+	return nil
+}
+
+func (s *Schedule) inWindow(t time.Time) bool {
+	t = t.In(s.Location)
+	today := midnight(t)
+	yesterday := today.AddDate(0, 0, -1)
+
+	for _, w := range s.Windows {
+		// the window opened today, or yesterday when it runs past midnight
+		for _, day := range []time.Time{today, yesterday} {
+			if !slices.Contains(w.Days, day.Weekday()) {
+				continue
+			}
+			from, to := w.bounds(day)
+			if !t.Before(from) && t.Before(to) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// nextStart returns the first window opening after t.
+func (s *Schedule) nextStart(t time.Time) (time.Time, bool) {
+	var (
+		next  time.Time
+		found bool
+	)
+	today := midnight(t.In(s.Location))
+	for i := range 8 {
+		day := today.AddDate(0, 0, i)
+		for _, w := range s.Windows {
+			if !slices.Contains(w.Days, day.Weekday()) {
+				continue
+			}
+			from, _ := w.bounds(day)
+			if from.After(t) && (!found || from.Before(next)) {
+				next, found = from, true
+			}
+		}
+	}
+	return next, found
+}
+
+// bounds returns when the window opens and closes on the day.
+func (w Window) bounds(day time.Time) (time.Time, time.Time) {
+	from := at(day, w.From)
+	to := at(day, w.To)
+	if !to.After(from) {
+		to = at(day.AddDate(0, 0, 1), w.To)
+	}
+	return from, to
+}
+
+func midnight(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// at returns the wall clock time on the day, which is not the same as adding
+// the offset to midnight on days the clocks change.
+func at(day time.Time, offset time.Duration) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(),
+		int(offset/time.Hour), int(offset%time.Hour/time.Minute), 0, 0, day.Location())
+}
@@ -0,0 +1,249 @@
+// Forge - Automated Docker container deployment tool for VPS environments.
+// Monitors Git repositories and redeploys containers on new commits.
+// Copyright (C) 2025 Artemii Fedotov
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+package window
+
+import (
+	"testing"
+	"time"
+)
+
+var (
+	weekdays = []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}
+	everyDay = []time.Weekday{time.Sunday, time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday}
+)
+
+func berlin(t *testing.T) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("no timezone data: %v", err)
+	}
+	return loc
+}
+
+func TestAllows(t *testing.T) {
+	loc := berlin(t)
+	date := func(day, hour, minute int) time.Time {
+		// October 2026 starts on a Thursday
+		return time.Date(2026, 10, day, hour, minute, 0, 0, loc)
+	}
+	office := Window{Days: weekdays, From: 9 * time.Hour, To: 17 * time.Hour}
+
+	tests := []struct {
+		name     string
+		schedule Schedule
+		at       time.Time
+		want     bool
+		reason   string
+	}{
+		{"inside window", Schedule{Windows: []Window{office}}, date(19, 10, 0), true, ""},
+		{"window start is inclusive", Schedule{Windows: []Window{office}}, date(19, 9, 0), true, ""},
+		{"window end is exclusive", Schedule{Windows: []Window{office}}, date(19, 17, 0), false, "outside deploy windows"},
+		{"weekend", Schedule{Windows: []Window{office}}, date(17, 10, 0), false, "outside deploy windows"},
+		{
+			name:     "past midnight, before it",
+			schedule: Schedule{Windows: []Window{{Days: []time.Weekday{time.Friday}, From: 22 * time.Hour, To: 2 * time.Hour}}},
+			at:       date(16, 23, 0),
+			want:     true,
+		},
+		{
+			name:     "past midnight, after it",
+			schedule: Schedule{Windows: []Window{{Days: []time.Weekday{time.Friday}, From: 22 * time.Hour, To: 2 * time.Hour}}},
+			at:       date(17, 1, 30),
+			want:     true,
+		},
+		{
+			name:     "past midnight, window closed",
+			schedule: Schedule{Windows: []Window{{Days: []time.Weekday{time.Friday}, From: 22 * time.Hour, To: 2 * time.Hour}}},
+			at:       date(17, 2, 0),
+			reason:   "outside deploy windows",
+		},
+		{
+			name:     "past midnight, opened on another day",
+			schedule: Schedule{Windows: []Window{{Days: []time.Weekday{time.Friday}, From: 22 * time.Hour, To: 2 * time.Hour}}},
+			at:       date(16, 1, 0),
+			reason:   "outside deploy windows",
+		},
+		{
+			name:     "until 24:00",
+			schedule: Schedule{Windows: []Window{{Days: []time.Weekday{time.Monday}, From: 18 * time.Hour, To: 24 * time.Hour}}},
+			at:       date(19, 23, 59),
+			want:     true,
+		},
+		{
+			name:     "after 24:00",
+			schedule: Schedule{Windows: []Window{{Days: []time.Weekday{time.Monday}, From: 18 * time.Hour, To: 24 * time.Hour}}},
+			at:       date(20, 0, 0),
+			reason:   "outside deploy windows",
+		},
+		{
+			name:     "same start and end is a whole day",
+			schedule: Schedule{Windows: []Window{{Days: []time.Weekday{time.Monday}}}},
+			at:       date(19, 12, 0),
+			want:     true,
+		},
+		{
+			name: "freeze inside window",
+			schedule: Schedule{
+				Windows: []Window{office},
+				Freezes: []Freeze{{From: date(19, 0, 0), To: date(21, 0, 0), Reason: "release"}},
+			},
+			at:     date(19, 10, 0),
+			reason: "change freeze until 2026-10-21 00:00:00: release",
+		},
+		{
+			name:     "freeze end is exclusive",
+			schedule: Schedule{Freezes: []Freeze{{From: date(19, 0, 0), To: date(21, 0, 0)}}},
+			at:       date(21, 0, 0),
+			want:     true,
+		},
+		{"no windows", Schedule{}, date(17, 3, 0), true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.schedule.Location = loc
+			got, reason := tt.schedule.Allows(tt.at)
+			if got != tt.want || reason != tt.reason {
+				t.Errorf("Allows(%s) = %v, %q, want %v, %q", tt.at, got, reason, tt.want, tt.reason)
+			}
+		})
+	}
+}
+
+func TestAllowsAcrossDST(t *testing.T) {
+	loc := berlin(t)
+	// clocks go forward from 02:00 to 03:00 on Sunday 29 March 2026
+	night := Schedule{
+		Location: loc,
+		Windows:  []Window{{Days: []time.Weekday{time.Saturday}, From: 22 * time.Hour, To: 6 * time.Hour}},
+	}
+
+	tests := []struct {
+		at   time.Time
+		want bool
+	}{
+		{time.Date(2026, 3, 28, 22, 0, 0, 0, loc), true},
+		{time.Date(2026, 3, 29, 1, 59, 0, 0, loc), true},
+		{time.Date(2026, 3, 29, 5, 59, 0, 0, loc), true},
+		{time.Date(2026, 3, 29, 6, 0, 0, 0, loc), false},
+	}
+	for _, tt := range tests {
+		if got, _ := night.Allows(tt.at); got != tt.want {
+			t.Errorf("Allows(%s) = %v, want %v", tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	loc := berlin(t)
+	date := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2026, month, day, hour, minute, 0, 0, loc)
+	}
+	office := Window{Days: weekdays, From: 9 * time.Hour, To: 17 * time.Hour}
+
+	tests := []struct {
+		name     string
+		schedule Schedule
+		from     time.Time
+		want     time.Time
+	}{
+		{"already open", Schedule{Windows: []Window{office}}, date(10, 19, 10, 0), date(10, 19, 10, 0)},
+		{"later today", Schedule{Windows: []Window{office}}, date(10, 19, 7, 0), date(10, 19, 9, 0)},
+		{"after the weekend", Schedule{Windows: []Window{office}}, date(10, 16, 17, 0), date(10, 19, 9, 0)},
+		{
+			name: "fri-mon wraps around the week",
+			schedule: Schedule{Windows: []Window{{
+				Days: []time.Weekday{time.Friday, time.Saturday, time.Sunday, time.Monday},
+				From: 20 * time.Hour, To: 23 * time.Hour,
+			}}},
+			from: date(10, 20, 0, 0),
+			want: date(10, 23, 20, 0),
+		},
+		{
+			name:     "freeze thaws inside a window",
+			schedule: Schedule{Windows: []Window{office}, Freezes: []Freeze{{From: date(10, 19, 0, 0), To: date(10, 19, 12, 0)}}},
+			from:     date(10, 19, 10, 0),
+			want:     date(10, 19, 12, 0),
+		},
+		{
+			name:     "freeze thaws outside windows",
+			schedule: Schedule{Windows: []Window{office}, Freezes: []Freeze{{From: date(10, 19, 0, 0), To: date(10, 21, 20, 0)}}},
+			from:     date(10, 19, 10, 0),
+			want:     date(10, 22, 9, 0),
+		},
+		{
+			name:     "freeze covers the next window",
+			schedule: Schedule{Windows: []Window{office}, Freezes: []Freeze{{From: date(10, 17, 0, 0), To: date(10, 19, 10, 0)}}},
+			from:     date(10, 17, 12, 0),
+			want:     date(10, 19, 10, 0),
+		},
+		{
+			name: "back to back freezes",
+			schedule: Schedule{Freezes: []Freeze{
+				{From: date(12, 24, 0, 0), To: date(12, 27, 0, 0)},
+				{From: date(12, 27, 0, 0), To: date(12, 31, 0, 0)},
+			}},
+			from: date(12, 25, 8, 0),
+			want: date(12, 31, 0, 0),
+		},
+		{
+			// 09:00 is 07:00 UTC once the clocks went forward
+			name:     "spring forward",
+			schedule: Schedule{Windows: []Window{{Days: everyDay, From: 9 * time.Hour, To: 17 * time.Hour}}},
+			from:     date(3, 28, 18, 0),
+			want:     time.Date(2026, 3, 29, 7, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "fall back",
+			schedule: Schedule{Windows: []Window{{Days: everyDay, From: 9 * time.Hour, To: 17 * time.Hour}}},
+			from:     date(10, 24, 18, 0),
+			want:     time.Date(2026, 10, 25, 8, 0, 0, 0, time.UTC),
+		},
+		{"never opens", Schedule{Windows: []Window{{From: 9 * time.Hour, To: 17 * time.Hour}}}, date(10, 19, 7, 0), time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.schedule.Location = loc
+			if got := tt.schedule.Next(tt.from); !got.Equal(tt.want) {
+				t.Errorf("Next(%s) = %s, want %s", tt.from, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextAllows(t *testing.T) {
+	loc := berlin(t)
+	s := Schedule{
+		Location: loc,
+		Windows: []Window{
+			{Days: weekdays, From: 9 * time.Hour, To: 17 * time.Hour},
+			{Days: []time.Weekday{time.Saturday}, From: 23 * time.Hour, To: time.Hour},
+		},
+		Freezes: []Freeze{{
+			From: time.Date(2026, 12, 20, 0, 0, 0, 0, loc),
+			To:   time.Date(2027, 1, 4, 0, 0, 0, 0, loc),
+		}},
+	}
+
+	// whatever Next returns must be allowed
+	for at := time.Date(2026, 12, 1, 0, 0, 0, 0, loc); at.Year() == 2026; at = at.Add(97 * time.Minute) {
+		next := s.Next(at)
+		if ok, reason := s.Allows(next); !ok || next.Before(at) {
+			t.Fatalf("Next(%s) = %s, which is not allowed: %s", at, next, reason)
+		}
+	}
+}